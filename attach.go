@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/docker/pkg/term"
+	"github.com/opencontainers/runc/libcontainer"
+
+	"github.com/applidget/psdock/control"
+)
+
+const (
+	consoleSocket     = "console.sock"
+	detachedLog       = "psdock.log"          // log of a detached launcher in its state directory, kept once it exited
+	detachedIDEnv     = "_PSDOCK_DETACHED_ID" // set by the launcher for its detached copy
+	defaultDetachKeys = "ctrl-p,ctrl-q"
+)
+
+var errDetached = errors.New("detached")
+
+// detach runs psdock again in a new session with the same arguments and returns once the container
+// console is available. Errors of the detached psdock are printed if it exits before
+func detach(c *cli.Context) (int, error) {
+	cuid, err := newContainerID(c)
+	if err != nil {
+		return 1, err
+	}
+
+	logFile, err := ioutil.TempFile("", "psdock_detach_")
+	if err != nil {
+		return 1, err
+	}
+	defer os.Remove(logFile.Name())
+	defer logFile.Close()
+
+	cmd := exec.Command("/proc/self/exe", os.Args[1:]...)
+	cmd.Env = append(os.Environ(), detachedIDEnv+"="+cuid)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return 1, err
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	for {
+		if _, err := os.Stat(filepath.Join(containersRoot, cuid, consoleSocket)); err == nil {
+			fmt.Println(cuid)
+			return 0, nil
+		}
+
+		select {
+		case err := <-exited:
+			out, _ := ioutil.ReadFile(logFile.Name())
+			os.Stderr.Write(out)
+			// logged in the state directory once it was ready
+			out, _ = ioutil.ReadFile(filepath.Join(containersRoot, cuid, detachedLog))
+			os.Stderr.Write(out)
+			return 1, fmt.Errorf("detached psdock exited: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// redirect the standard output and error of the detached launcher, nobody reads the ones it was started with
+func redirectOutput(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, fd := range []int{syscall.Stdout, syscall.Stderr} {
+		if err := syscall.Dup3(int(f.Fd()), fd, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consoleServer exposes a container console on a unix socket. One client can be attached at a time,
+// a new client replaces the current one. Console output is copied to output (-stdio) if set, it is dropped
+// when no client is attached otherwise
+type consoleServer struct {
+	console  libcontainer.Console
+	listener net.Listener
+	output   io.Writer
+	mutex    sync.Mutex
+	client   net.Conn
+}
+
+func serveConsole(console libcontainer.Console, socketPath string, output io.Writer) (*consoleServer, error) {
+	// until a client sends the size of its terminal (see attachAction), use a sane default
+	if err := term.SetWinsize(console.Fd(), &term.Winsize{Height: 24, Width: 80}); err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	s := &consoleServer{console: console, listener: l, output: output}
+	go s.copyOutput()
+	go s.acceptClients()
+	return s, nil
+}
+
+func (s *consoleServer) copyOutput() {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := s.console.Read(buf)
+		if n > 0 {
+			if s.output != nil {
+				s.output.Write(buf[:n])
+			}
+			s.mutex.Lock()
+			if s.client != nil {
+				s.client.Write(buf[:n])
+			}
+			s.mutex.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *consoleServer) acceptClients() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		if s.client != nil {
+			s.client.Close()
+		}
+		s.client = conn
+		s.mutex.Unlock()
+
+		go func() {
+			io.Copy(s.console, conn)
+
+			// client detached, the process keeps running
+			s.mutex.Lock()
+			if s.client == conn {
+				s.client = nil
+			}
+			s.mutex.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+func (s *consoleServer) Close() error {
+	err := s.listener.Close()
+	s.mutex.Lock()
+	if s.client != nil {
+		s.client.Close()
+	}
+	s.mutex.Unlock()
+	return err
+}
+
+// attach the current terminal to the console of a detached container until the process exits
+// or the detach keys are typed
+func attachAction(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return fmt.Errorf("usage: psdock attach [OPTIONS] <container-id>")
+	}
+
+	keys, err := parseDetachKeys(c.String("detach-keys"))
+	if err != nil {
+		return err
+	}
+
+	id, err := resolveID(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.Dial("unix", filepath.Join(containersRoot, id, consoleSocket))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if term.IsTerminal(os.Stdin.Fd()) {
+		// the console takes the size of the terminal, best effort: the process may be waiting for a restart
+		client := control.NewClient(filepath.Join(containersRoot, id, controlSocket))
+		resize := func() {
+			if ws, err := term.GetWinsize(os.Stdin.Fd()); err == nil {
+				client.Resize(ws.Height, ws.Width)
+			}
+		}
+		resize()
+
+		winch := make(chan os.Signal, 1)
+		signal.Notify(winch, syscall.SIGWINCH)
+		defer func() {
+			signal.Stop(winch)
+			close(winch)
+		}()
+		go func() {
+			for range winch {
+				resize()
+			}
+		}()
+
+		state, err := term.SetRawTerminal(os.Stdin.Fd())
+		if err != nil {
+			return err
+		}
+		defer term.RestoreTerminal(os.Stdin.Fd(), state)
+	}
+
+	done := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(os.Stdout, conn)
+		done <- err
+	}()
+	go func() {
+		done <- copyUntilDetach(conn, os.Stdin, keys)
+	}()
+
+	if err := <-done; err != nil && err != errDetached {
+		return err
+	}
+	return nil
+}
+
+// copy src to dst until src is exhausted or the keys sequence is read, in this case errDetached is returned.
+// The keys sequence is not copied
+func copyUntilDetach(dst io.Writer, src io.Reader, keys []byte) error {
+	var (
+		buf     = make([]byte, 1024)
+		matched = 0 // number of keys of the sequence already read
+	)
+	for {
+		n, err := src.Read(buf)
+		var out bytes.Buffer
+		for _, b := range buf[:n] {
+			if b == keys[matched] {
+				matched++
+				if matched == len(keys) {
+					dst.Write(out.Bytes())
+					return errDetached
+				}
+				continue
+			}
+			// sequence broken, keys read so far were real input
+			out.Write(keys[:matched])
+			matched = 0
+			if b == keys[0] {
+				matched = 1
+				continue
+			}
+			out.WriteByte(b)
+		}
+		if _, werr := dst.Write(out.Bytes()); werr != nil {
+			return werr
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// expected format for detach keys: comma separated list of characters or ctrl-<char> (ex: ctrl-p,ctrl-q)
+func parseDetachKeys(raw string) ([]byte, error) {
+	var keys []byte
+	for _, key := range strings.Split(raw, ",") {
+		key = strings.TrimSpace(key)
+		if len(key) == 1 {
+			keys = append(keys, key[0])
+			continue
+		}
+
+		key = strings.ToLower(key)
+		switch {
+		case strings.HasPrefix(key, "ctrl-") && len(key) == 6 && key[5] >= 'a' && key[5] <= 'z':
+			keys = append(keys, key[5]-'a'+1)
+		case key == "ctrl-@", key == "ctrl-[", key == `ctrl-\`, key == "ctrl-]", key == "ctrl-^", key == "ctrl-_":
+			keys = append(keys, key[5]-'@')
+		default:
+			return nil, fmt.Errorf("invalid detach key %q", key)
+		}
+	}
+	return keys, nil
+}
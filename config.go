@@ -2,16 +2,46 @@ package main
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 	"syscall"
 
+	"github.com/codegangsta/cli"
 	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/devices"
+
+	"github.com/applidget/psdock/etcfiles"
 )
 
 const defaultMountFlags = syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV
 
-// expected format for bindmounts: /source/to/mount:/dest/to/mount[:ro|rw]
-func loadConfig(uid, rootfs, hostname string, bindMounts []string) (*configs.Config, error) {
+var (
+	defaultMaskPaths = []string{
+		"/proc/kcore", "/proc/keys", "/proc/latency_stats", "/proc/timer_list", "/proc/timer_stats", "/proc/sched_debug",
+	}
+	defaultReadonlyPaths = []string{
+		"/proc/sys", "/proc/sysrq-trigger", "/proc/irq", "/proc/bus",
+	}
+
+	// namespaced sysctls and the namespace they live in
+	namespacedSysctls = map[string]configs.NamespaceType{
+		"kernel.domainname":      configs.NEWUTS,
+		"kernel.msgmax":          configs.NEWIPC,
+		"kernel.msgmnb":          configs.NEWIPC,
+		"kernel.msgmni":          configs.NEWIPC,
+		"kernel.sem":             configs.NEWIPC,
+		"kernel.shmall":          configs.NEWIPC,
+		"kernel.shmmax":          configs.NEWIPC,
+		"kernel.shmmni":          configs.NEWIPC,
+		"kernel.shm_rmid_forced": configs.NEWIPC,
+	}
+	namespacedSysctlPrefixes = map[string]configs.NamespaceType{
+		"fs.mqueue.": configs.NEWIPC,
+		"net.":       configs.NEWNET,
+	}
+)
+
+func loadConfig(uid, rootfs string, c *cli.Context) (*configs.Config, error) {
 	var config = &configs.Config{
 		Rootfs:            rootfs,
 		ParentDeathSignal: int(syscall.SIGKILL),
@@ -41,16 +71,14 @@ func loadConfig(uid, rootfs, hostname string, bindMounts []string) (*configs.Con
 			Name:            uid,
 			Parent:          "psdock",
 			AllowAllDevices: false,
-			AllowedDevices:  configs.DefaultAllowedDevices,
-		},
-		Hostname: hostname,
-		Devices:  configs.DefaultAutoCreatedDevices,
-		MaskPaths: []string{
-			"/proc/kcore",
-		},
-		ReadonlyPaths: []string{
-			"/proc/sys", "/proc/sysrq-trigger", "/proc/irq", "/proc/bus",
+			AllowedDevices:  append([]*configs.Device{}, configs.DefaultAllowedDevices...), // -device appends to it
 		},
+		Hostname:      c.String("hostname"),
+		Devices:       append([]*configs.Device{}, configs.DefaultAutoCreatedDevices...),
+		MaskPaths:     pathList(defaultMaskPaths, c.StringSlice("mask-path")),
+		ReadonlyPaths: pathList(defaultReadonlyPaths, c.StringSlice("readonly-path")),
+		Readonlyfs:    c.Bool("read-only"),
+		Hooks:         prestartHooks(c.StringSlice("prestart-hook")),
 		Mounts: []*configs.Mount{
 			{
 				Source:      "proc",
@@ -91,12 +119,6 @@ func loadConfig(uid, rootfs, hostname string, bindMounts []string) (*configs.Con
 				Device:      "sysfs",
 				Flags:       defaultMountFlags | syscall.MS_RDONLY,
 			},
-			{
-				Source:      "/etc/resolv.conf",
-				Destination: "/etc/resolv.conf",
-				Device:      "bind",
-				Flags:       syscall.MS_BIND | syscall.MS_REC | syscall.MS_RDONLY,
-			},
 		},
 		Rlimits: []configs.Rlimit{
 			{
@@ -107,30 +129,263 @@ func loadConfig(uid, rootfs, hostname string, bindMounts []string) (*configs.Con
 		},
 	}
 
+	//a read only rootfs still needs some scratch space
+	if config.Readonlyfs {
+		config.Mounts = append(config.Mounts, &configs.Mount{
+			Source:      "tmpfs",
+			Destination: "/tmp",
+			Device:      "tmpfs",
+			Flags:       syscall.MS_NOSUID | syscall.MS_NODEV,
+			Data:        "mode=1777",
+		}, &configs.Mount{
+			Source:      "tmpfs",
+			Destination: "/run",
+			Device:      "tmpfs",
+			Flags:       syscall.MS_NOSUID | syscall.MS_NODEV,
+			Data:        "mode=755",
+		})
+	}
+
+	//use host dns configuration unless a custom one is generated
+	if resolvConf(c).Empty() {
+		config.Mounts = append(config.Mounts, &configs.Mount{
+			Source:      "/etc/resolv.conf",
+			Destination: "/etc/resolv.conf",
+			Device:      "bind",
+			Flags:       syscall.MS_BIND | syscall.MS_REC | syscall.MS_RDONLY,
+		})
+	}
+
+	//psdock is the init of procfile containers and of -init ones
+	if c.String("procfile") != "" || c.Bool("init") {
+		config.Mounts = append(config.Mounts, &configs.Mount{
+			Source:      psdockBinary(),
+			Destination: initPath,
+			Device:      "bind",
+			Flags:       syscall.MS_BIND | syscall.MS_RDONLY,
+		})
+	}
+
+	//psdock init reports the wait status of the command in the container state directory
+	if c.Bool("init") && c.String("procfile") == "" {
+		config.Mounts = append(config.Mounts, &configs.Mount{
+			Source:      filepath.Join(containersRoot, uid, initStatusFile),
+			Destination: initStatusPath,
+			Device:      "bind",
+			Flags:       syscall.MS_BIND,
+		})
+	}
+
+	//secrets tmpfs is mounted in the container state directory before the container is started
+	if len(c.StringSlice("secret")) > 0 {
+		config.Mounts = append(config.Mounts, &configs.Mount{
+			Source:      filepath.Join(containersRoot, uid, secretsDir),
+			Destination: secretsMountPath,
+			Device:      "bind",
+			Flags:       syscall.MS_BIND | syscall.MS_REC | syscall.MS_RDONLY,
+		})
+	}
+
+	//notify socket is created in the container state directory before the container is started
+	if c.Bool("notify") {
+		config.Mounts = append(config.Mounts, &configs.Mount{
+			Source:      filepath.Join(containersRoot, uid, notifySocket),
+			Destination: notifySocketPath,
+			Device:      "bind",
+			Flags:       syscall.MS_BIND,
+		})
+	}
+
 	//abb bind mounts if any
-	for _, rawBind := range bindMounts {
-		mount := &configs.Mount{
-			Device: "bind",
-			Flags:  syscall.MS_BIND | syscall.MS_REC,
-		}
-		parts := strings.SplitN(rawBind, ":", 3)
-		switch len(parts) {
-		default:
-			return nil, fmt.Errorf("invalid bind mount %s", rawBind)
-		case 2:
-			mount.Source, mount.Destination = parts[0], parts[1]
-		case 3:
-			mount.Source, mount.Destination = parts[0], parts[1]
-			switch parts[2] {
-			case "ro":
-				mount.Flags |= syscall.MS_RDONLY
-			case "rw":
-			default:
-				return nil, fmt.Errorf("invalid bind mount mode %s", parts[2])
-			}
+	for _, rawBind := range c.StringSlice("bind-mount") {
+		mount, err := parseBindMount(rawBind)
+		if err != nil {
+			return nil, err
 		}
 		config.Mounts = append(config.Mounts, mount)
 	}
 
+	//add host devices if any
+	for _, rawDevice := range c.StringSlice("device") {
+		device, err := parseDevice(rawDevice)
+		if err != nil {
+			return nil, err
+		}
+		config.Devices = append(config.Devices, device)
+		config.Cgroups.AllowedDevices = append(config.Cgroups.AllowedDevices, device)
+	}
+
+	//add sysctls if any
+	for _, rawSysctl := range c.StringSlice("sysctl") {
+		parts := strings.SplitN(rawSysctl, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid sysctl %s", rawSysctl)
+		}
+		if err := validateSysctl(parts[0], config.Namespaces); err != nil {
+			return nil, err
+		}
+		if config.Sysctl == nil {
+			config.Sysctl = make(map[string]string)
+		}
+		config.Sysctl[parts[0]] = parts[1]
+	}
+
 	return config, nil
 }
+
+// user given paths extend the default ones, unless "none" is given (anywhere) which drops the defaults only
+func pathList(defaults, paths []string) []string {
+	list := []string{}
+	keepDefaults := true
+	for _, p := range paths {
+		if p == "none" {
+			keepDefaults = false
+			continue
+		}
+		list = append(list, p)
+	}
+	if keepDefaults {
+		list = append(append([]string{}, defaults...), list...)
+	}
+	return list
+}
+
+// generate /etc/hosts, /etc/hostname and if needed /etc/resolv.conf directly in the rootfs
+func writeEtcFiles(rootfs string, c *cli.Context) error {
+	hostname := c.String("hostname")
+
+	var extraHosts []etcfiles.Host
+	for _, rawHost := range c.StringSlice("add-host") {
+		h, err := etcfiles.ParseHost(rawHost)
+		if err != nil {
+			return err
+		}
+		extraHosts = append(extraHosts, h)
+	}
+
+	if err := etcfiles.WriteHosts(filepath.Join(rootfs, "etc", "hosts"), hostname, extraHosts); err != nil {
+		return err
+	}
+	if err := etcfiles.WriteHostname(filepath.Join(rootfs, "etc", "hostname"), hostname); err != nil {
+		return err
+	}
+
+	rc := resolvConf(c)
+	if rc.Empty() {
+		return nil //host resolv.conf bind mounted
+	}
+	if len(rc.Nameservers) == 0 {
+		// only search domains or options given, the host nameservers are kept
+		ns, err := etcfiles.Nameservers("/etc/resolv.conf")
+		if err != nil {
+			return fmt.Errorf("failed to get the host nameservers (%v), use -dns to set them", err)
+		}
+		rc.Nameservers = ns
+	}
+	return etcfiles.WriteResolvConf(filepath.Join(rootfs, "etc", "resolv.conf"), rc)
+}
+
+func resolvConf(c *cli.Context) *etcfiles.ResolvConf {
+	return &etcfiles.ResolvConf{
+		Nameservers: c.StringSlice("dns"),
+		Search:      c.StringSlice("dns-search"),
+		Options:     c.StringSlice("dns-option"),
+	}
+}
+
+// only sysctls isolated by one of the container namespaces can be set, others would change the host settings
+func validateSysctl(key string, namespaces configs.Namespaces) error {
+	nsType, ok := namespacedSysctls[key]
+	if !ok {
+		for prefix, t := range namespacedSysctlPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				nsType, ok = t, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return fmt.Errorf("sysctl %s is not namespaced and can't be set in a container", key)
+	}
+	if !namespaces.Contains(nsType) {
+		return fmt.Errorf("sysctl %s requires a %s namespace which is not created by psdock", key, nsType)
+	}
+	return nil
+}
+
+// expected format for bindmounts: /source/to/mount:/dest/to/mount[:ro|rw]
+func parseBindMount(rawBind string) (*configs.Mount, error) {
+	mount := &configs.Mount{
+		Device: "bind",
+		Flags:  syscall.MS_BIND | syscall.MS_REC,
+	}
+	parts := strings.SplitN(rawBind, ":", 3)
+	switch len(parts) {
+	default:
+		return nil, fmt.Errorf("invalid bind mount %s", rawBind)
+	case 2:
+		mount.Source, mount.Destination = parts[0], parts[1]
+	case 3:
+		mount.Source, mount.Destination = parts[0], parts[1]
+		switch parts[2] {
+		case "ro":
+			mount.Flags |= syscall.MS_RDONLY
+		case "rw":
+		default:
+			return nil, fmt.Errorf("invalid bind mount mode %s", parts[2])
+		}
+	}
+	return mount, nil
+}
+
+// expected format for devices: /dev/on/host[:/dev/in/container][:rwm]
+// type, major and minor numbers are read from the host device node
+func parseDevice(rawDevice string) (*configs.Device, error) {
+	var (
+		parts       = strings.Split(rawDevice, ":")
+		hostPath    = parts[0]
+		path        = hostPath
+		permissions = "rwm"
+	)
+
+	switch len(parts) {
+	default:
+		return nil, fmt.Errorf("invalid device %s", rawDevice)
+	case 1:
+	case 2:
+		if validDevicePermissions(parts[1]) {
+			permissions = parts[1]
+		} else {
+			path = parts[1]
+		}
+	case 3:
+		path, permissions = parts[1], parts[2]
+		if !validDevicePermissions(permissions) {
+			return nil, fmt.Errorf("invalid device permissions %s", permissions)
+		}
+	}
+
+	if !strings.HasPrefix(path, "/dev/") {
+		return nil, fmt.Errorf("invalid device path %s, must be under /dev", path)
+	}
+
+	device, err := devices.DeviceFromPath(hostPath, permissions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid device %s: %v", hostPath, err)
+	}
+	device.Path = path
+	return device, nil
+}
+
+// device cgroup permissions are a combination of r (read), w (write) and m (mknod)
+func validDevicePermissions(permissions string) bool {
+	if permissions == "" {
+		return false
+	}
+	for _, p := range permissions {
+		if !strings.ContainsRune("rwm", p) {
+			return false
+		}
+	}
+	return true
+}
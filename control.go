@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/opencontainers/runc/libcontainer"
+
+	"github.com/applidget/psdock/control"
+)
+
+const (
+	controlSocket = "control.sock"
+
+	// interval between the two samples used to compute rates of the stats served by the control API
+	controlStatsInterval = 200 * time.Millisecond
+)
+
+var errNotRunning = errors.New("process not running, waiting for a restart")
+
+// controlBackend exposes the container of a launcher through the control API, for its whole life (restarts included)
+type controlBackend struct {
+	l *launcher
+}
+
+// container running the current process
+func (b *controlBackend) container() (libcontainer.Container, error) {
+	container := b.l.signalHandler.currentContainer()
+	if container == nil {
+		return nil, errNotRunning
+	}
+	return container, nil
+}
+
+func (b *controlBackend) Status() string {
+	return string(currentStatus())
+}
+
+func (b *controlBackend) Processes() ([]int, error) {
+	container, err := b.container()
+	if err != nil {
+		return nil, err
+	}
+	return container.Processes()
+}
+
+func (b *controlBackend) Stats() (interface{}, error) {
+	container, err := b.container()
+	if err != nil {
+		return nil, err
+	}
+	prev, err := container.Stats()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	time.Sleep(controlStatsInterval)
+
+	cur, err := container.Stats()
+	if err != nil {
+		return nil, err
+	}
+	pids, err := container.Processes()
+	if err != nil {
+		return nil, err
+	}
+	return computeStats(b.l.id, statsSample{at: start, stats: prev}, statsSample{at: time.Now(), stats: cur}, len(pids)), nil
+}
+
+func (b *controlBackend) Signal(sig syscall.Signal) error {
+	if _, err := b.container(); err != nil {
+		return err
+	}
+	return b.l.signalHandler.handleDefault(sig)
+}
+
+// Stop also works while the process is waiting for a restart, it won't be restarted
+func (b *controlBackend) Stop(sig syscall.Signal, timeout time.Duration) error {
+	if sig == 0 {
+		// -stop-signal
+		return b.l.signalHandler.stop(nil, timeout)
+	}
+	return b.l.signalHandler.stop(sig, timeout)
+}
+
+func (b *controlBackend) Pause() error {
+	container, err := b.container()
+	if err != nil {
+		return err
+	}
+	return b.l.pause(container)
+}
+
+func (b *controlBackend) Resume() error {
+	container, err := b.container()
+	if err != nil {
+		return err
+	}
+	return b.l.resume(container)
+}
+
+func (b *controlBackend) Resize(height, width uint16) error {
+	if !b.l.detached {
+		return errors.New("only the console of detached containers can be resized")
+	}
+	_, tty := b.l.signalHandler.current()
+	if tty == nil {
+		return errNotRunning
+	}
+	return tty.setSize(height, width)
+}
+
+// serve the control API of the container in its state directory, status changes are published to it until closeControl
+func (l *launcher) serveControl() error {
+	server, err := control.Listen(filepath.Join(containersRoot, l.id, controlSocket), &controlBackend{l: l})
+	if err != nil {
+		return err
+	}
+
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	controlServer = server
+	return nil
+}
+
+func closeControl() {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+
+	if controlServer != nil {
+		controlServer.Close()
+		controlServer = nil
+	}
+}
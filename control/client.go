@@ -0,0 +1,102 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Client talks to the control API of a container
+type Client struct {
+	http *http.Client
+}
+
+// NewClient returns a client of the API served on the unix socket at path
+func NewClient(path string) *Client {
+	return &Client{http: &http.Client{Transport: &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		},
+	}}}
+}
+
+// Status returns the current status of the container
+func (c *Client) Status() (string, error) {
+	resp, err := c.http.Get("http://psdock/status")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp, http.StatusOK); err != nil {
+		return "", err
+	}
+	var status statusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return "", err
+	}
+	return status.Status, nil
+}
+
+// Signal sends sig to the container process
+func (c *Client) Signal(sig syscall.Signal) error {
+	return c.post("/signal?signal="+strconv.Itoa(int(sig)), http.StatusNoContent)
+}
+
+// Stop gracefully stops the container by sending sig (0 for the container stop signal) to the process, it is killed
+// after timeout (a negative timeout means the default one). It returns once the stop is initiated, not when the
+// container exited
+func (c *Client) Stop(sig syscall.Signal, timeout time.Duration) error {
+	query := url.Values{}
+	if sig != 0 {
+		query.Set("signal", strconv.Itoa(int(sig)))
+	}
+	if timeout >= 0 {
+		query.Set("timeout", timeout.String())
+	}
+	return c.post("/stop?"+query.Encode(), http.StatusAccepted)
+}
+
+// Pause freezes every process of the container
+func (c *Client) Pause() error {
+	return c.post("/pause", http.StatusNoContent)
+}
+
+// Resume thaws every process of the container
+func (c *Client) Resume() error {
+	return c.post("/resume", http.StatusNoContent)
+}
+
+// Resize sets the size of the container console
+func (c *Client) Resize(height, width uint16) error {
+	query := url.Values{}
+	query.Set("height", strconv.Itoa(int(height)))
+	query.Set("width", strconv.Itoa(int(width)))
+	return c.post("/resize?"+query.Encode(), http.StatusNoContent)
+}
+
+func (c *Client) post(path string, expected int) error {
+	resp, err := c.http.Post("http://psdock"+path, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp, expected)
+}
+
+func checkResponse(resp *http.Response, expected int) error {
+	if resp.StatusCode == expected {
+		return nil
+	}
+	var e errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return errors.New(e.Error)
+}
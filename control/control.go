@@ -0,0 +1,304 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/applidget/psdock/system"
+)
+
+// Backend is the container controlled through the API
+type Backend interface {
+	Status() string
+	Processes() ([]int, error)
+	Stats() (interface{}, error)
+	Signal(sig syscall.Signal) error
+	// Stop gracefully stops the container by sending sig (0 for the container stop signal) to the process, it is
+	// killed after timeout (a negative timeout means the default one). The process must not be restarted
+	Stop(sig syscall.Signal, timeout time.Duration) error
+	// Pause freezes every process of the container, Resume thaws them
+	Pause() error
+	Resume() error
+	// Resize sets the size of the container console (psdock attach)
+	Resize(height, width uint16) error
+}
+
+// Server serves the HTTP/JSON control API of a container on a unix socket:
+//
+//	GET  /status                               current status
+//	GET  /processes                            pids of the container processes
+//	GET  /stats                                resource usage
+//	POST /signal?signal=NAME                   deliver a signal to the process
+//	POST /stop[?signal=NAME&timeout=10s]       gracefully stop the container (container stop signal by default)
+//	POST /pause                                freeze every process of the container
+//	POST /resume                               thaw every process of the container
+//	POST /resize?height=24&width=80            set the size of the container console
+//	GET  /events                               server-sent events stream of status changes
+type Server struct {
+	backend  Backend
+	listener net.Listener
+
+	mutex       sync.Mutex
+	subscribers map[chan string]bool
+	closed      chan struct{}
+}
+
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+type processesResponse struct {
+	Pids []int `json:"pids"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// buffered status changes per events client, changes are dropped for clients too slow to read them
+const subscriberBufferSize = 16
+
+// Listen creates the unix socket at path and starts serving the API
+func Listen(path string, backend Backend) (*Server, error) {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	s := &Server{
+		backend:     backend,
+		listener:    l,
+		subscribers: make(map[chan string]bool),
+		closed:      make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/processes", s.handleProcesses)
+	mux.HandleFunc("/stats", s.handleStats)
+	mux.HandleFunc("/signal", s.handleSignal)
+	mux.HandleFunc("/stop", s.handleStop)
+	mux.HandleFunc("/pause", s.handleFreezer(s.backend.Pause))
+	mux.HandleFunc("/resume", s.handleFreezer(s.backend.Resume))
+	mux.HandleFunc("/resize", s.handleResize)
+	mux.HandleFunc("/events", s.handleEvents)
+
+	go http.Serve(l, mux)
+	return s, nil
+}
+
+// Publish sends a status change to the events clients
+func (s *Server) Publish(status string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for ch := range s.subscribers {
+		select {
+		case ch <- status:
+		default:
+		}
+	}
+}
+
+// Close stops serving the API and ends the events streams
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	select {
+	case <-s.closed:
+		return nil
+	default:
+	}
+	close(s.closed)
+	return s.listener.Close()
+}
+
+func (s *Server) subscribe() chan string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ch := make(chan string, subscriberBufferSize)
+	s.subscribers[ch] = true
+	return ch
+}
+
+func (s *Server) unsubscribe(ch chan string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.subscribers, ch)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, "GET") {
+		return
+	}
+	writeJSON(w, http.StatusOK, &statusResponse{Status: s.backend.Status()})
+}
+
+func (s *Server) handleProcesses(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, "GET") {
+		return
+	}
+	pids, err := s.backend.Processes()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &processesResponse{Pids: pids})
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, "GET") {
+		return
+	}
+	stats, err := s.backend.Stats()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (s *Server) handleSignal(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, "POST") {
+		return
+	}
+	sig, err := system.ParseSignal(r.URL.Query().Get("signal"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.backend.Signal(sig); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, "POST") {
+		return
+	}
+	var sig syscall.Signal // let the backend use its stop signal
+	if raw := r.URL.Query().Get("signal"); raw != "" {
+		var err error
+		if sig, err = system.ParseSignal(raw); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	timeout := time.Duration(-1) // let the backend use its default
+	if raw := r.URL.Query().Get("timeout"); raw != "" {
+		var err error
+		if timeout, err = time.ParseDuration(raw); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if err := s.backend.Stop(sig, timeout); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// the container is stopping, clients wait for it on the events stream
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// pause or resume the container
+func (s *Server) handleFreezer(action func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, "POST") {
+			return
+		}
+		if err := action(); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) handleResize(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, "POST") {
+		return
+	}
+	height, err := strconv.ParseUint(r.URL.Query().Get("height"), 10, 16)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid height: %v", err))
+		return
+	}
+	width, err := strconv.ParseUint(r.URL.Query().Get("width"), 10, 16)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid width: %v", err))
+		return
+	}
+	if err := s.backend.Resize(uint16(height), uint16(width)); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, "GET") {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	ch := s.subscribe()
+	defer s.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// current status first so that clients don't miss anything between a GET /status and the stream
+	status := s.backend.Status()
+	for {
+		data, _ := json.Marshal(&statusResponse{Status: status})
+		if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case status = <-ch:
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, &errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,283 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type fakeBackend struct {
+	mutex      sync.Mutex
+	signals    []syscall.Signal
+	stopSignal syscall.Signal
+	stopped    time.Duration
+	paused     bool
+	size       [2]uint16
+}
+
+func (b *fakeBackend) Status() string            { return "running" }
+func (b *fakeBackend) Processes() ([]int, error) { return []int{42, 43}, nil }
+
+func (b *fakeBackend) Stats() (interface{}, error) {
+	return map[string]int{"pids": 2}, nil
+}
+
+func (b *fakeBackend) Signal(sig syscall.Signal) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.signals = append(b.signals, sig)
+	return nil
+}
+
+func (b *fakeBackend) Stop(sig syscall.Signal, timeout time.Duration) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.stopSignal, b.stopped = sig, timeout
+	return nil
+}
+
+func (b *fakeBackend) Pause() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.paused {
+		return errors.New("already paused")
+	}
+	b.paused = true
+	return nil
+}
+
+func (b *fakeBackend) Resume() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.paused = false
+	return nil
+}
+
+func (b *fakeBackend) Resize(height, width uint16) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.size = [2]uint16{height, width}
+	return nil
+}
+
+func startServer(t *testing.T) (*Server, *fakeBackend, *http.Client, func()) {
+	s, backend, _, client, cleanup := startServerAndClient(t)
+	return s, backend, client, cleanup
+}
+
+func startServerAndClient(t *testing.T) (*Server, *fakeBackend, *Client, *http.Client, func()) {
+	dir, err := ioutil.TempDir("", "psdock-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "control.sock")
+
+	backend := &fakeBackend{}
+	s, err := Listen(path, backend)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		},
+	}}
+	return s, backend, NewClient(path), client, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func Test_statusAndProcesses(t *testing.T) {
+	fmt.Printf("control status and processes ... ")
+
+	_, _, client, cleanup := startServer(t)
+	defer cleanup()
+
+	resp, err := client.Get("http://psdock/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status statusResponse
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != "running" {
+		t.Fatalf("expected running got %s", status.Status)
+	}
+
+	resp, err = client.Get("http://psdock/processes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var processes processesResponse
+	err = json.NewDecoder(resp.Body).Decode(&processes)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(processes.Pids) != 2 || processes.Pids[0] != 42 {
+		t.Fatalf("unexpected pids %v", processes.Pids)
+	}
+
+	resp, err = client.Post("http://psdock/status", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 got %d", resp.StatusCode)
+	}
+	fmt.Println("done")
+}
+
+func Test_signalAndStop(t *testing.T) {
+	fmt.Printf("control signal and stop ... ")
+
+	_, backend, client, cleanup := startServer(t)
+	defer cleanup()
+
+	resp, err := client.Post("http://psdock/signal?signal=HUP", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 got %d", resp.StatusCode)
+	}
+	if len(backend.signals) != 1 || backend.signals[0] != syscall.SIGHUP {
+		t.Fatalf("expected SIGHUP to be delivered got %v", backend.signals)
+	}
+
+	resp, err = client.Post("http://psdock/signal?signal=FOO", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 got %d", resp.StatusCode)
+	}
+
+	resp, err = client.Post("http://psdock/stop?timeout=3s", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202 got %d", resp.StatusCode)
+	}
+	if backend.stopSignal != 0 || backend.stopped != 3*time.Second {
+		t.Fatalf("expected the default signal with a 3s timeout got %v %v", backend.stopSignal, backend.stopped)
+	}
+	fmt.Println("done")
+}
+
+func Test_events(t *testing.T) {
+	fmt.Printf("control events ... ")
+
+	s, _, client, cleanup := startServer(t)
+	defer cleanup()
+
+	resp, err := client.Get("http://psdock/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %s", ct)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	next := func() string {
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasPrefix(line, "data: ") {
+				return strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+			}
+		}
+	}
+
+	if data := next(); data != `{"status":"running"}` {
+		t.Fatalf("expected current status first got %s", data)
+	}
+
+	s.Publish("crashed")
+	if data := next(); data != `{"status":"crashed"}` {
+		t.Fatalf("expected crashed got %s", data)
+	}
+
+	s.Close()
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("done")
+}
+
+func Test_client(t *testing.T) {
+	fmt.Printf("control client ... ")
+
+	_, backend, client, _, cleanup := startServerAndClient(t)
+	defer cleanup()
+
+	status, err := client.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != "running" {
+		t.Fatalf("expected running got %s", status)
+	}
+
+	if err := client.Signal(syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.signals) != 1 || backend.signals[0] != syscall.SIGUSR1 {
+		t.Fatalf("expected SIGUSR1 to be delivered got %v", backend.signals)
+	}
+
+	if err := client.Stop(0, -1); err != nil {
+		t.Fatal(err)
+	}
+	if backend.stopSignal != 0 || backend.stopped != -1 {
+		t.Fatalf("expected the default stop signal and timeout got %v %v", backend.stopSignal, backend.stopped)
+	}
+	if err := client.Stop(syscall.SIGQUIT, 1500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if backend.stopSignal != syscall.SIGQUIT || backend.stopped != 1500*time.Millisecond {
+		t.Fatalf("expected a SIGQUIT with a 1.5s timeout got %v %v", backend.stopSignal, backend.stopped)
+	}
+
+	if err := client.Pause(); err != nil || !backend.paused {
+		t.Fatalf("expected the container to be paused got %v", err)
+	}
+	if err := client.Pause(); err == nil || err.Error() != "already paused" {
+		t.Fatalf("expected the backend error got %v", err)
+	}
+	if err := client.Resume(); err != nil || backend.paused {
+		t.Fatalf("expected the container to be resumed got %v", err)
+	}
+
+	if err := client.Resize(50, 132); err != nil || backend.size != [2]uint16{50, 132} {
+		t.Fatalf("expected the console to be resized to 50x132 got %v %v", backend.size, err)
+	}
+	fmt.Println("done")
+}
@@ -0,0 +1,162 @@
+package environ
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// ParseFile reads environment variables from a dotenv file
+func ParseFile(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	env, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return env, nil
+}
+
+// Parse reads environment variables in the dotenv format:
+//
+//	# comment
+//	export FOO=bar
+//	BAR="multi\nline" # comment
+//	BAZ='literal $value'
+func Parse(r io.Reader) ([]string, error) {
+	var env []string
+
+	s := bufio.NewScanner(r)
+	for lineNo := 1; s.Scan(); lineNo++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		parts := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || !validKey(key) {
+			return nil, fmt.Errorf("line %d: invalid variable %q", lineNo, line)
+		}
+
+		value, err := parseValue(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		env = append(env, key+"="+value)
+	}
+	return env, s.Err()
+}
+
+func parseValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	switch quote := raw[0]; quote {
+	case '\'', '"':
+		end := closingQuote(raw, quote)
+		if end == -1 {
+			return "", fmt.Errorf("unterminated quoted value %s", raw)
+		}
+		if rest := strings.TrimSpace(raw[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected characters after quoted value %s", raw)
+		}
+		value := raw[1:end]
+		if quote == '"' {
+			value = unescape(value)
+		}
+		return value, nil
+	default:
+		//unquoted values end at the first inline comment
+		if i := strings.Index(raw, " #"); i != -1 {
+			raw = raw[:i]
+		}
+		return strings.TrimSpace(raw), nil
+	}
+}
+
+// index of the quote closing the value, escaped double quotes are skipped
+func closingQuote(raw string, quote byte) int {
+	for i := 1; i < len(raw); i++ {
+		if quote == '"' && raw[i] == '\\' {
+			i++
+			continue
+		}
+		if raw[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+func unescape(value string) string {
+	r := strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`)
+	return r.Replace(value)
+}
+
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, c := range key {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Inherit returns variables of env whose name match one of the given shell patterns (ex: AWS_*)
+func Inherit(patterns, env []string) ([]string, error) {
+	var inherited []string
+	for _, v := range env {
+		for _, pattern := range patterns {
+			match, err := path.Match(pattern, key(v))
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %v", pattern, err)
+			}
+			if match {
+				inherited = append(inherited, v)
+				break
+			}
+		}
+	}
+	return inherited, nil
+}
+
+// Merge merges environments, a variable set in a later environment overrides the earlier ones.
+// Variables are kept in order of first appearance
+func Merge(envs ...[]string) []string {
+	var (
+		merged  []string
+		indexes = make(map[string]int)
+	)
+	for _, env := range envs {
+		for _, v := range env {
+			k := key(v)
+			if i, ok := indexes[k]; ok {
+				merged[i] = v
+				continue
+			}
+			indexes[k] = len(merged)
+			merged = append(merged, v)
+		}
+	}
+	return merged
+}
+
+func key(v string) string {
+	return strings.SplitN(v, "=", 2)[0]
+}
@@ -0,0 +1,74 @@
+package environ
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_parse(t *testing.T) {
+	fmt.Printf("parse dotenv ... ")
+
+	content := `
+# database settings
+export DB_HOST=localhost
+DB_PORT = 5432 # inline comment
+GREETING="hello \"world\"\nbye"
+LITERAL='no $expansion # here'
+EMPTY=
+`
+	env, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"DB_HOST=localhost",
+		"DB_PORT=5432",
+		"GREETING=hello \"world\"\nbye",
+		"LITERAL=no $expansion # here",
+		"EMPTY=",
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Fatalf("expected %q got %q", expected, env)
+	}
+
+	for _, invalid := range []string{"FOO", "1FOO=bar", "FOO=\"bar", "FOO='bar' baz"} {
+		if _, err := Parse(strings.NewReader(invalid)); err == nil {
+			t.Fatalf("%s should be rejected", invalid)
+		}
+	}
+	fmt.Println("done")
+}
+
+func Test_inherit(t *testing.T) {
+	fmt.Printf("inherit env ... ")
+
+	host := []string{"HOME=/root", "AWS_KEY=foo", "AWS_SECRET=bar", "LANG=C"}
+	env, err := Inherit([]string{"AWS_*", "LANG"}, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"AWS_KEY=foo", "AWS_SECRET=bar", "LANG=C"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Fatalf("expected %v got %v", expected, env)
+	}
+
+	if _, err := Inherit([]string{"["}, host); err == nil {
+		t.Fatal("invalid pattern should be rejected")
+	}
+	fmt.Println("done")
+}
+
+func Test_merge(t *testing.T) {
+	fmt.Printf("merge env ... ")
+
+	env := Merge([]string{"PATH=/bin", "TERM=xterm"}, []string{"FOO=bar"}, []string{"TERM=vt100", "FOO=baz"})
+	expected := []string{"PATH=/bin", "TERM=vt100", "FOO=baz"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Fatalf("expected %v got %v", expected, env)
+	}
+	fmt.Println("done")
+}
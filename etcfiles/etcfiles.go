@@ -0,0 +1,119 @@
+package etcfiles
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// default entries of a generated /etc/hosts, the container hostname is resolved on the loopback
+// as containers share the host network
+var defaultHosts = []Host{
+	{IP: "127.0.0.1", Names: []string{"localhost"}},
+	{IP: "::1", Names: []string{"localhost", "ip6-localhost", "ip6-loopback"}},
+	{IP: "fe00::0", Names: []string{"ip6-localnet"}},
+	{IP: "ff00::0", Names: []string{"ip6-mcastprefix"}},
+	{IP: "ff02::1", Names: []string{"ip6-allnodes"}},
+	{IP: "ff02::2", Names: []string{"ip6-allrouters"}},
+}
+
+type Host struct {
+	IP    string
+	Names []string
+}
+
+// expected format for hosts: name:ip (ipv6 addresses may contain colons)
+func ParseHost(raw string) (Host, error) {
+	parts := strings.SplitN(raw, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return Host{}, fmt.Errorf("invalid host %s", raw)
+	}
+	if net.ParseIP(parts[1]) == nil {
+		return Host{}, fmt.Errorf("invalid ip address %s for host %s", parts[1], parts[0])
+	}
+	return Host{IP: parts[1], Names: []string{parts[0]}}, nil
+}
+
+type ResolvConf struct {
+	Nameservers []string
+	Search      []string
+	Options     []string
+}
+
+func (rc *ResolvConf) Empty() bool {
+	return len(rc.Nameservers) == 0 && len(rc.Search) == 0 && len(rc.Options) == 0
+}
+
+// WriteHosts writes an hosts file resolving localhost, the given hostname and the extra hosts
+func WriteHosts(path, hostname string, extraHosts []Host) error {
+	var buf bytes.Buffer
+	hosts := make([]Host, 0, len(defaultHosts)+len(extraHosts)+1)
+	hosts = append(hosts, defaultHosts...)
+	hosts = append(hosts, Host{IP: "127.0.1.1", Names: []string{hostname}})
+	for _, h := range append(hosts, extraHosts...) {
+		fmt.Fprintf(&buf, "%s\t%s\n", h.IP, strings.Join(h.Names, " "))
+	}
+	return writeFile(path, buf.Bytes())
+}
+
+func WriteHostname(path, hostname string) error {
+	return writeFile(path, []byte(hostname+"\n"))
+}
+
+// Nameservers returns the nameservers of the resolv.conf file at path, it fails if there are none. Loopback
+// nameservers are kept as containers share the host network
+func Nameservers(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var nameservers []string
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "nameserver" && net.ParseIP(fields[1]) != nil {
+			nameservers = append(nameservers, fields[1])
+		}
+	}
+	if len(nameservers) == 0 {
+		return nil, fmt.Errorf("no nameserver in %s", path)
+	}
+	return nameservers, nil
+}
+
+// WriteResolvConf writes a resolv.conf file, at most 6 search domains are allowed by the resolver
+func WriteResolvConf(path string, rc *ResolvConf) error {
+	var buf bytes.Buffer
+	for _, ns := range rc.Nameservers {
+		if net.ParseIP(ns) == nil {
+			return fmt.Errorf("invalid nameserver %s", ns)
+		}
+		fmt.Fprintf(&buf, "nameserver %s\n", ns)
+	}
+	if len(rc.Search) > 6 {
+		return fmt.Errorf("too many search domains (%d), at most 6 are allowed", len(rc.Search))
+	}
+	if len(rc.Search) > 0 {
+		fmt.Fprintf(&buf, "search %s\n", strings.Join(rc.Search, " "))
+	}
+	if len(rc.Options) > 0 {
+		fmt.Fprintf(&buf, "options %s\n", strings.Join(rc.Options, " "))
+	}
+	return writeFile(path, buf.Bytes())
+}
+
+// the image may ship the file as a symlink (possibly absolute, pointing outside of the rootfs),
+// so any existing file is removed rather than written through
+func writeFile(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
@@ -0,0 +1,136 @@
+package etcfiles
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_parseHost(t *testing.T) {
+	fmt.Printf("parse host ... ")
+
+	h, err := ParseHost("db:10.0.0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.IP != "10.0.0.2" || h.Names[0] != "db" {
+		t.Fatalf("unexpected host %v", h)
+	}
+
+	h, err = ParseHost("db6:fe80::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.IP != "fe80::1" {
+		t.Fatalf("expected ipv6 address fe80::1 got %s", h.IP)
+	}
+
+	for _, raw := range []string{"db", ":10.0.0.2", "db:not_an_ip"} {
+		if _, err := ParseHost(raw); err == nil {
+			t.Fatalf("%s should be rejected", raw)
+		}
+	}
+	fmt.Println("done")
+}
+
+func Test_writeHosts(t *testing.T) {
+	fmt.Printf("write hosts ... ")
+
+	dir, err := ioutil.TempDir("", "psdock_etc_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//existing symlinks must not be followed
+	target := filepath.Join(dir, "target")
+	if err := ioutil.WriteFile(target, []byte("untouched"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hostsPath := filepath.Join(dir, "etc", "hosts")
+	os.MkdirAll(filepath.Dir(hostsPath), 0755)
+	if err := os.Symlink(target, hostsPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteHosts(hostsPath, "foobar", []Host{{IP: "10.0.0.2", Names: []string{"db"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := ioutil.ReadFile(hostsPath)
+	content := string(b)
+	for _, line := range []string{"127.0.0.1\tlocalhost\n", "127.0.1.1\tfoobar\n", "10.0.0.2\tdb\n"} {
+		if !strings.Contains(content, line) {
+			t.Fatalf("expected %q in hosts file, got %s", line, content)
+		}
+	}
+
+	b, _ = ioutil.ReadFile(target)
+	if string(b) != "untouched" {
+		t.Fatalf("symlink target must not be modified, got %s", string(b))
+	}
+	fmt.Println("done")
+}
+
+func Test_writeResolvConf(t *testing.T) {
+	fmt.Printf("write resolv.conf ... ")
+
+	f, err := ioutil.TempFile("", "psdock_resolv_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	rc := &ResolvConf{
+		Nameservers: []string{"8.8.8.8", "8.8.4.4"},
+		Search:      []string{"example.com"},
+		Options:     []string{"ndots:2", "timeout:1"},
+	}
+	if err := WriteResolvConf(f.Name(), rc); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := ioutil.ReadFile(f.Name())
+	expected := "nameserver 8.8.8.8\nnameserver 8.8.4.4\nsearch example.com\noptions ndots:2 timeout:1\n"
+	if string(b) != expected {
+		t.Fatalf("expected %q got %q", expected, string(b))
+	}
+
+	if err := WriteResolvConf(f.Name(), &ResolvConf{Nameservers: []string{"foo"}}); err == nil {
+		t.Fatal("invalid nameserver should be rejected")
+	}
+	fmt.Println("done")
+}
+
+func Test_nameservers(t *testing.T) {
+	fmt.Printf("read nameservers ... ")
+
+	f, err := ioutil.TempFile("", "psdock_resolv_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# generated\nnameserver 10.0.0.2\nsearch example.com\n nameserver\t127.0.0.53 \nnameserver foo\n")
+	f.Close()
+
+	ns, err := Nameservers(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ns) != 2 || ns[0] != "10.0.0.2" || ns[1] != "127.0.0.53" {
+		t.Fatalf("unexpected nameservers %v", ns)
+	}
+
+	ioutil.WriteFile(f.Name(), []byte("search example.com\n"), 0644)
+	if ns, err := Nameservers(f.Name()); err == nil {
+		t.Fatalf("a resolv.conf without nameserver should be rejected, got %v", ns)
+	}
+	if ns, err := Nameservers("/nonexistent/resolv.conf"); err == nil {
+		t.Fatalf("a missing resolv.conf should be rejected, got %v", ns)
+	}
+	fmt.Println("done")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/opencontainers/runc/libcontainer"
+
+	"github.com/applidget/psdock/environ"
+	"github.com/applidget/psdock/stream"
+	"github.com/applidget/psdock/system"
+)
+
+// run an additional process inside a running container, returns the process exit status
+func execAction(c *cli.Context) (int, error) {
+	if len(c.Args()) < 2 {
+		return 1, fmt.Errorf("usage: psdock exec [OPTIONS] <container-id> command")
+	}
+
+	id, err := resolveID(c.Args().First())
+	if err != nil {
+		return 1, err
+	}
+
+	container, err := loadContainer(id)
+	if err != nil {
+		return 1, err
+	}
+
+	process := &libcontainer.Process{
+		Args: c.Args().Tail(),
+		Env:  environ.Merge(standardEnv, c.StringSlice("env")),
+		User: c.String("user"),
+		Cwd:  c.String("cwd"),
+	}
+
+	s, err := stream.NewStream("", "", stream.NoColor)
+	if err != nil {
+		return 1, err
+	}
+	defer s.Close()
+
+	if c.Bool("tty") && !s.Terminal() {
+		log.Warn("not run from a terminal, no tty allocated")
+	}
+
+	var tty *tty
+	if c.Bool("tty") && s.Terminal() {
+		config := container.Config()
+		rootuid, err := config.HostUID()
+		if err != nil {
+			return 1, err
+		}
+
+		tty, err = newTty(process, rootuid)
+		if err != nil {
+			return 1, err
+		}
+		defer tty.Close()
+
+		if err := tty.attach(s); err != nil {
+			return 1, err
+		}
+		tty.resize()
+	} else {
+		process.Stdin = os.Stdin
+		process.Stdout = os.Stdout
+		process.Stderr = os.Stderr
+	}
+
+	if err := container.Start(process); err != nil {
+		return 1, err
+	}
+
+	go forwardSignals(process, tty)
+
+	return wait(process)
+}
+
+// the exec'd process is not the container init, signals are forwarded as is (but those raised by psdock itself)
+func forwardSignals(process *libcontainer.Process, tty *tty) {
+	sigc := make(chan os.Signal, signalBufferSize)
+	signal.Notify(sigc)
+
+	for sig := range sigc {
+		switch sig {
+		case syscall.SIGWINCH:
+			if tty != nil {
+				tty.resize()
+			}
+		default:
+			if system.Forwarded(sig) {
+				process.Signal(sig)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/opencontainers/runc/libcontainer"
+
+	"github.com/applidget/psdock/exitreason"
+	"github.com/applidget/psdock/notifier"
+)
+
+const (
+	// written in the state directory once psdock exits, the directory is kept until the name is reused or for
+	// exitRetention
+	exitFile = "exit.json"
+
+	// out of memory events may be received after the exit of the killed process
+	oomGracePeriod = 100 * time.Millisecond
+)
+
+// oomWatcher records out of memory kills in the container
+type oomWatcher struct {
+	killed chan struct{} // closed on the first kill, nil if kills can't be detected
+	once   sync.Once
+}
+
+func watchOOM(container libcontainer.Container) *oomWatcher {
+	w := &oomWatcher{}
+	events, err := container.NotifyOOM()
+	if err != nil {
+		log.Warnf("out of memory kills won't be reported: %v", err)
+		return w
+	}
+
+	w.killed = make(chan struct{})
+	go func() {
+		// closed once the container cgroup is removed
+		for range events {
+			w.once.Do(func() { close(w.killed) })
+		}
+	}()
+	return w
+}
+
+// oomKilled tells whether a process of the container was killed because it was out of memory. Only failed
+// processes may have been killed, the event is waited for a while
+func (w *oomWatcher) oomKilled(failed bool) bool {
+	if w.killed == nil || !failed {
+		return false
+	}
+	select {
+	case <-w.killed:
+		return true
+	case <-time.After(oomGracePeriod):
+		return false
+	}
+}
+
+// resetInitStatus creates the empty file in which psdock init reports the wait status of the command (-init), it
+// is writable by any user as the command may not run as root
+func resetInitStatus(id string) error {
+	path := filepath.Join(containersRoot, id, initStatusFile)
+	if err := ioutil.WriteFile(path, nil, 0666); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0666) // not masked by the umask
+}
+
+// readInitStatus returns the wait status of the command reported by psdock init, false if psdock init didn't
+// report it (it was killed before the command exited)
+func readInitStatus(id string) (syscall.WaitStatus, bool) {
+	b, err := ioutil.ReadFile(filepath.Join(containersRoot, id, initStatusFile))
+	if err != nil {
+		return 0, false
+	}
+	status, err := strconv.ParseUint(string(b), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return syscall.WaitStatus(status), true
+}
+
+// classifyExit returns why the process exited
+func (l *launcher) classifyExit(f exitreason.Facts) *exitreason.Exit {
+	select {
+	case <-l.timedOut:
+		f.TimedOut = true
+	default:
+	}
+	e := exitreason.Classify(f)
+	log.Debugf("process exited: %+v", *e)
+	return e
+}
+
+// report the end of a run of the process along with how it exited, e is nil if the process couldn't be run
+func (l *launcher) reportExit(e *exitreason.Exit) {
+	l.exit = e
+
+	status := notifier.StatusCrashed
+	if e != nil && e.Success() {
+		status = notifier.StatusExited
+	}
+	psChanged(l.c, &notifier.Ps{Status: status, Exit: e})
+}
+
+// writeExit records how the container exited in its state directory (removed by the container destruction)
+func writeExit(id string, e *exitreason.Exit) error {
+	dir := filepath.Join(containersRoot, id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, exitFile), b, 0644)
+}
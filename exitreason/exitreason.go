@@ -0,0 +1,78 @@
+package exitreason
+
+import (
+	"syscall"
+
+	"github.com/applidget/psdock/system"
+)
+
+// Reason tells why the process exited
+type Reason string
+
+const (
+	Exited        Reason = "exited"          // exit status 0
+	Failed        Reason = "failed"          // non zero exit status
+	Signaled      Reason = "signaled"        // killed by a signal
+	OOMKilled     Reason = "oom_killed"      // killed by the kernel, out of memory
+	TimedOut      Reason = "timed_out"       // stopped once -timeout elapsed
+	Killed        Reason = "killed"          // killed by psdock after it was asked to stop
+	FailedToStart Reason = "failed_to_start" // not ready before -startup-timeout
+)
+
+// psdock exit codes overriding the process exit status
+const (
+	CodeTimedOut      = 124 // as timeout(1)
+	CodeFailedToStart = 125
+)
+
+// Facts is what is known once the process exited
+type Facts struct {
+	Status        int            // exit status, 128 + signal number if killed by a signal
+	Signal        syscall.Signal // signal that killed the process, 0 if it exited
+	OOM           bool           // the kernel killed a process of the container because it was out of memory
+	TimedOut      bool
+	FailedToStart bool
+	Forced        bool // SIGKILL was sent by psdock to stop the process
+	Requested     bool // the stop was requested from outside psdock (signal, psdock stop, control API)
+}
+
+// Exit is the classified exit of the process
+type Exit struct {
+	Reason Reason `json:"reason"`
+	Code   int    `json:"code"`             // exit code of psdock
+	Status int    `json:"status"`           // exit status of the process
+	Signal string `json:"signal,omitempty"` // signal that killed the process (ex: SIGSEGV)
+}
+
+// Classify returns why the process exited, the first matching reason in this order: timed out, failed to start,
+// out of memory, killed after a stop request, killed by a signal, non zero exit status, exit status 0
+func Classify(f Facts) *Exit {
+	e := &Exit{Code: f.Status, Status: f.Status}
+	if f.Signal != 0 {
+		e.Signal = system.SignalName(f.Signal)
+	}
+
+	switch {
+	case f.TimedOut:
+		e.Reason, e.Code = TimedOut, CodeTimedOut
+	case f.FailedToStart:
+		e.Reason, e.Code = FailedToStart, CodeFailedToStart
+	case f.OOM && f.Status != 0:
+		e.Reason = OOMKilled
+	case f.Forced && f.Requested && f.Signal == syscall.SIGKILL:
+		// psdock was asked to stop the process, being killed is expected
+		e.Reason, e.Code = Killed, 0
+	case f.Signal != 0:
+		e.Reason = Signaled
+	case f.Status != 0:
+		e.Reason = Failed
+	default:
+		e.Reason = Exited
+	}
+	return e
+}
+
+// Success tells whether the exit is not an error
+func (e *Exit) Success() bool {
+	return e.Code == 0
+}
@@ -0,0 +1,40 @@
+package exitreason
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func Test_classify(t *testing.T) {
+	fmt.Printf("classify exits ... ")
+
+	cases := []struct {
+		facts    Facts
+		expected Exit
+	}{
+		{Facts{}, Exit{Reason: Exited}},
+		{Facts{Status: 3}, Exit{Reason: Failed, Code: 3, Status: 3}},
+		{Facts{Status: 139, Signal: syscall.SIGSEGV}, Exit{Reason: Signaled, Code: 139, Status: 139, Signal: "SIGSEGV"}},
+		{Facts{Status: 137, Signal: syscall.SIGKILL}, Exit{Reason: Signaled, Code: 137, Status: 137, Signal: "SIGKILL"}},
+		{Facts{Status: 137, Signal: syscall.SIGKILL, OOM: true}, Exit{Reason: OOMKilled, Code: 137, Status: 137, Signal: "SIGKILL"}},
+		{Facts{Status: 137, Signal: syscall.SIGKILL, Forced: true, Requested: true}, Exit{Reason: Killed, Status: 137, Signal: "SIGKILL"}},
+		// killed by psdock because it failed (watchdog, required process ...)
+		{Facts{Status: 137, Signal: syscall.SIGKILL, Forced: true}, Exit{Reason: Signaled, Code: 137, Status: 137, Signal: "SIGKILL"}},
+		{Facts{Status: 143, Signal: syscall.SIGTERM, Forced: true, Requested: true}, Exit{Reason: Signaled, Code: 143, Status: 143, Signal: "SIGTERM"}},
+		{Facts{Status: 137, Signal: syscall.SIGKILL, Forced: true, TimedOut: true}, Exit{Reason: TimedOut, Code: CodeTimedOut, Status: 137, Signal: "SIGKILL"}},
+		{Facts{Status: 137, Signal: syscall.SIGKILL, Forced: true, FailedToStart: true}, Exit{Reason: FailedToStart, Code: CodeFailedToStart, Status: 137, Signal: "SIGKILL"}},
+		// a process that exited normally is not oom killed, even if one of its children was
+		{Facts{OOM: true}, Exit{Reason: Exited}},
+	}
+	for _, c := range cases {
+		if e := Classify(c.facts); *e != c.expected {
+			t.Fatalf("%+v: expected %+v got %+v", c.facts, c.expected, *e)
+		}
+	}
+
+	if !Classify(Facts{}).Success() || Classify(Facts{Status: 1}).Success() {
+		t.Fatal("only a zero exit code is a success")
+	}
+	fmt.Println("done")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/opencontainers/runc/libcontainer"
+
+	"github.com/applidget/psdock/health"
+	"github.com/applidget/psdock/notifier"
+)
+
+// validate the health-* flags, checked once on start
+func checkHealthFlags(c *cli.Context) error {
+	probers := 0
+	for _, flag := range []string{"health-cmd", "health-http", "health-tcp"} {
+		if c.String(flag) != "" {
+			probers++
+		}
+	}
+	switch {
+	case probers == 0:
+		return nil
+	case probers > 1:
+		return fmt.Errorf("only one of -health-cmd, -health-http and -health-tcp can be specified")
+	case c.Duration("health-interval") <= 0 || c.Duration("health-timeout") <= 0 || c.Int("health-retries") <= 0:
+		return fmt.Errorf("health check interval, timeout and retries must be positive")
+	}
+	return nil
+}
+
+// build a health checker from the health-* flags (see checkHealthFlags), returns nil if no health check is configured
+func newHealthChecker(c *cli.Context, container libcontainer.Container, env []string) *health.Checker {
+	var prober health.Prober
+	switch {
+	case c.String("health-cmd") != "":
+		prober = execProber(container, c.String("health-cmd"), env, c.String("user"))
+	case c.String("health-http") != "":
+		prober = &health.HTTPProber{URL: c.String("health-http")}
+	case c.String("health-tcp") != "":
+		prober = &health.TCPProber{Address: c.String("health-tcp")}
+	default:
+		return nil
+	}
+
+	return &health.Checker{
+		Prober:      prober,
+		Interval:    c.Duration("health-interval"),
+		Timeout:     c.Duration("health-timeout"),
+		Retries:     c.Int("health-retries"),
+		StartPeriod: c.Duration("health-start-period"),
+		Skip: func() bool {
+			// probes of a frozen process would time out
+			status, err := container.Status()
+			return err == nil && status != libcontainer.Running
+		},
+	}
+}
+
+// run cmd inside the container namespaces, the probe succeeds if it exits with a 0 status
+func execProber(container libcontainer.Container, cmd string, env []string, user string) health.Prober {
+	return health.ProberFunc(func(timeout time.Duration) error {
+		process := &libcontainer.Process{
+			Args: []string{"/bin/sh", "-c", cmd},
+			Env:  env,
+			User: user,
+		}
+		if err := container.Start(process); err != nil {
+			return err
+		}
+
+		timer := time.AfterFunc(timeout, func() {
+			process.Signal(syscall.SIGKILL)
+		})
+		_, err := process.Wait()
+		if !timer.Stop() {
+			return fmt.Errorf("health command timed out after %v", timeout)
+		}
+		return err
+	})
+}
+
+// report health changes, and kill an unhealthy process if asked to (restart policy will then apply). Returns once
+// exited is closed and the in-flight probe is over
+func watchHealth(c *cli.Context, checker *health.Checker, process *libcontainer.Process, exited <-chan struct{}) {
+	checker.Run(exited, func(healthy bool, err error) {
+		if healthy {
+			statusChanged(c, notifier.StatusHealthy)
+			return
+		}
+
+		log.Errorf("health check failed: %v", err)
+		statusChanged(c, notifier.StatusUnhealthy)
+		if c.Bool("health-restart") {
+			process.Signal(syscall.SIGKILL)
+		}
+	})
+}
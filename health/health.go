@@ -0,0 +1,107 @@
+package health
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Prober performs a single health probe, it returns an error if the process is not healthy
+type Prober interface {
+	Probe(timeout time.Duration) error
+}
+
+// ProberFunc adapts a function to the Prober interface
+type ProberFunc func(timeout time.Duration) error
+
+func (f ProberFunc) Probe(timeout time.Duration) error {
+	return f(timeout)
+}
+
+// HTTPProber expects a GET on URL to answer with a 2xx status code
+type HTTPProber struct {
+	URL string
+}
+
+func (p *HTTPProber) Probe(timeout time.Duration) error {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(p.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("bad status code expected 200 .. 299 got %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// TCPProber expects Address to accept connections
+type TCPProber struct {
+	Address string
+}
+
+func (p *TCPProber) Probe(timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", p.Address, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Checker runs a probe periodically. The process is healthy as soon as a probe succeeds and unhealthy
+// after Retries consecutive failures. Failures during StartPeriod are not counted
+type Checker struct {
+	Prober      Prober
+	Interval    time.Duration
+	Timeout     time.Duration
+	Retries     int
+	StartPeriod time.Duration
+	Skip        func() bool // optional, when it returns true no probe is performed (ex: process paused)
+}
+
+// Run probes until stop is closed, onChange is called each time the health status changes
+func (c *Checker) Run(stop <-chan struct{}, onChange func(healthy bool, err error)) {
+	var (
+		startedAt = time.Now()
+		failures  = 0
+		known     = false // no status reported yet
+		healthy   = false
+	)
+
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if c.Skip != nil && c.Skip() {
+			continue
+		}
+
+		err := c.Prober.Probe(c.Timeout)
+		if err == nil {
+			failures = 0
+			if !known || !healthy {
+				known, healthy = true, true
+				onChange(true, nil)
+			}
+			continue
+		}
+
+		if time.Since(startedAt) < c.StartPeriod {
+			continue
+		}
+		failures++
+		if failures >= c.Retries && (!known || healthy) {
+			known, healthy = true, false
+			onChange(false, err)
+		}
+	}
+}
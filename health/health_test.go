@@ -0,0 +1,99 @@
+package health
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_httpProber(t *testing.T) {
+	fmt.Printf("http prober ... ")
+
+	code := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}))
+	defer ts.Close()
+
+	p := &HTTPProber{URL: ts.URL + "/health"}
+	if err := p.Probe(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	code = http.StatusServiceUnavailable
+	if err := p.Probe(time.Second); err == nil {
+		t.Fatal("a 503 status code must fail the probe")
+	}
+	fmt.Println("done")
+}
+
+func Test_tcpProber(t *testing.T) {
+	fmt.Printf("tcp prober ... ")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &TCPProber{Address: ln.Addr().String()}
+	if err := p.Probe(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	ln.Close()
+	if err := p.Probe(time.Second); err == nil {
+		t.Fatal("probing a closed port must fail")
+	}
+	fmt.Println("done")
+}
+
+func Test_checker(t *testing.T) {
+	fmt.Printf("health checker ... ")
+
+	var (
+		mutex   sync.Mutex
+		results = []bool{true, false, false, false, false, true}
+		changes []bool
+	)
+
+	probe := ProberFunc(func(timeout time.Duration) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if len(results) == 0 {
+			return nil
+		}
+		ok := results[0]
+		results = results[1:]
+		if !ok {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	})
+
+	c := &Checker{Prober: probe, Interval: time.Millisecond, Timeout: time.Second, Retries: 3}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.Run(stop, func(healthy bool, err error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			changes = append(changes, healthy)
+		})
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	<-done
+
+	//healthy, unhealthy after 3 failures (the 4th is not reported), healthy again
+	expected := []bool{true, false, true}
+	if fmt.Sprint(changes) != fmt.Sprint(expected) {
+		t.Fatalf("expected health changes %v got %v", expected, changes)
+	}
+	fmt.Println("done")
+}
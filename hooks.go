@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/opencontainers/runc/libcontainer/configs"
+
+	"github.com/applidget/psdock/exitreason"
+)
+
+type hookStage string
+
+const (
+	preStart  hookStage = "pre-start"
+	postStart hookStage = "post-start"
+	postStop  hookStage = "post-stop"
+)
+
+// hookEnv describes the container to host hooks, fields are passed as PSDOCK_* environment variables
+type hookEnv struct {
+	id       string
+	rootfs   string
+	pid      int // 0 if the process is not started
+	exitCode int // -1 if the process didn't exit or its exit status is unknown
+}
+
+func (e *hookEnv) environ() []string {
+	env := []string{
+		"PSDOCK_CONTAINER_ID=" + e.id,
+		"PSDOCK_ROOTFS=" + e.rootfs,
+	}
+	if e.pid > 0 {
+		env = append(env, fmt.Sprintf("PSDOCK_PID=%d", e.pid))
+	}
+	if e.exitCode >= 0 {
+		env = append(env, fmt.Sprintf("PSDOCK_EXIT_CODE=%d", e.exitCode))
+	}
+	return env
+}
+
+// run the post-stop hooks once a started process is over, whatever happened. result is nil if its exit is unknown
+func runPostStop(c *cli.Context, env *hookEnv, result *exitreason.Exit) {
+	if result != nil {
+		env.exitCode = result.Code
+	}
+	if err := runHooks(c, postStop, env); err != nil {
+		log.Error(err)
+	}
+}
+
+// run the hooks of the given stage on the host. With the "ignore" failure policy, failures are only logged
+func runHooks(c *cli.Context, stage hookStage, env *hookEnv) error {
+	for _, cmd := range c.StringSlice(string(stage)) {
+		err := runHook(cmd, env.environ(), c.Duration("hook-timeout"))
+		if err == nil {
+			continue
+		}
+
+		err = fmt.Errorf("%s hook %q failed: %v", stage, cmd, err)
+		if c.String("hook-failure") == "ignore" {
+			log.Error(err)
+			continue
+		}
+		return err
+	}
+	return nil
+}
+
+// hooks run in their own process group, so that the whole group is killed on timeout
+func runHook(cmd string, env []string, timeout time.Duration) error {
+	command := exec.Command("/bin/sh", "-c", cmd)
+	command.Env = append(os.Environ(), env...)
+	command.Stdout = os.Stderr
+	command.Stderr = os.Stderr
+	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := command.Start(); err != nil {
+		return err
+	}
+
+	if timeout <= 0 {
+		return command.Wait()
+	}
+
+	timer := time.AfterFunc(timeout, func() {
+		syscall.Kill(-command.Process.Pid, syscall.SIGKILL)
+	})
+	err := command.Wait()
+	if !timer.Stop() {
+		return fmt.Errorf("timed out after %v", timeout)
+	}
+	return err
+}
+
+// libcontainer prestart hooks are run once the container namespaces are created, before the process is started.
+// They are given the container state (with the init pid) as json on stdin
+func prestartHooks(cmds []string) *configs.Hooks {
+	if len(cmds) == 0 {
+		return nil
+	}
+	hooks := &configs.Hooks{}
+	for _, cmd := range cmds {
+		hooks.Prestart = append(hooks.Prestart, configs.NewCommandHook(configs.Command{
+			Path: "/bin/sh",
+			Args: []string{"/bin/sh", "-c", cmd},
+			Env:  os.Environ(),
+		}))
+	}
+	return hooks
+}
@@ -0,0 +1,14 @@
+#!/bin/bash
+
+#bash script used to test the notify socket (netcat must support unix datagram sockets)
+
+function notify {
+  printf "$1" | nc -U -u -w1 $NOTIFY_SOCKET
+}
+
+notify "STATUS=booting"
+sleep 1
+notify "READY=1"
+sleep 1
+notify "WATCHDOG=trigger"
+sleep 100
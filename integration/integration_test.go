@@ -1,6 +1,7 @@
 package integration
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -9,8 +10,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/applidget/psdock/exitreason"
 	"github.com/applidget/psdock/notifier"
 )
 
@@ -51,6 +56,58 @@ func Test_envAndHostname(t *testing.T) {
 	fmt.Println("done")
 }
 
+func Test_envFileAndInherit(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing env files and inheritance ... ")
+
+	f, err := ioutil.TempFile("", "psdock_test_env_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprintln(f, "# comment\nFOO='from file'\nBAR=overridden")
+	f.Close()
+
+	os.Setenv("PSDOCK_TEST_INHERITED", "inherited")
+	defer os.Unsetenv("PSDOCK_TEST_INHERITED")
+
+	b := newBinary()
+	err = b.start("-image", imagePath, "-rootfs", rootfsPath, "-env-file", f.Name(), "-env-inherit", "PSDOCK_TEST_*", "-e", "BAR=bar",
+		"bash", "-c", "echo $FOO && echo $BAR && echo $PSDOCK_TEST_INHERITED && echo $TERM && test -n \"$PSDOCK_CONTAINER_ID\"")
+	if err != nil {
+		fmt.Println(b.debugInfo())
+		t.Fatal(err)
+	}
+
+	cleanStdout := strings.Trim(string(b.stdout), "\n")
+	expected := "from file\nbar\ninherited\nxterm"
+	if cleanStdout != expected {
+		t.Fatalf("expected output to be %q got %q", expected, cleanStdout)
+	}
+
+	fmt.Println("done")
+}
+
+func Test_etcFiles(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing generated etc files ... ")
+	b := newBinary()
+	err := b.start("-image", imagePath, "-rootfs", rootfsPath, "-hostname", "foobar", "-add-host", "db:10.0.0.2", "-dns", "8.8.8.8",
+		"bash", "-c", "getent hosts foobar db | awk '{ print $1 }' && cat /etc/hostname && grep nameserver /etc/resolv.conf")
+	if err != nil {
+		fmt.Println(b.debugInfo())
+		t.Fatal(err)
+	}
+
+	cleanStdout := strings.Trim(string(b.stdout), "\n")
+	expected := "127.0.1.1\n10.0.0.2\nfoobar\nnameserver 8.8.8.8"
+	if cleanStdout != expected {
+		t.Fatalf("expected output to be %q got %q", expected, cleanStdout)
+	}
+
+	fmt.Println("done")
+}
+
 func Test_bindMount(t *testing.T) {
 	beforeTest(t)
 	fmt.Printf("testing bind mounts ... ")
@@ -73,12 +130,97 @@ func Test_bindMount(t *testing.T) {
 	fmt.Println("done")
 }
 
+func Test_device(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing devices ... ")
+
+	b := newBinary()
+	err := b.start("-image", imagePath, "-rootfs", rootfsPath, "-device", "/dev/null:/dev/psdock_null:rw", "bash", "-c", "test -c /dev/psdock_null && echo foo > /dev/psdock_null")
+	if err != nil {
+		fmt.Println(b.debugInfo())
+		t.Fatal(err)
+	}
+
+	fmt.Println("done")
+}
+
+func Test_sysctl(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing sysctls ... ")
+
+	b := newBinary()
+	err := b.start("-image", imagePath, "-rootfs", rootfsPath, "-sysctl", "kernel.msgmax=4096", "cat", "/proc/sys/kernel/msgmax")
+	if err != nil {
+		fmt.Println(b.debugInfo())
+		t.Fatal(err)
+	}
+
+	cleanStdout := strings.Trim(string(b.stdout), "\n")
+	if cleanStdout != "4096" {
+		t.Fatalf("expected output to be 4096 got %s", cleanStdout)
+	}
+
+	b = newBinary()
+	if err := b.start("-image", imagePath, "-rootfs", rootfsPath, "-sysctl", "net.core.somaxconn=1024", "ls"); err == nil {
+		t.Fatal("net sysctl must be rejected without a network namespace")
+	}
+
+	fmt.Println("done")
+}
+
+func Test_readOnly(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing read only rootfs ... ")
+
+	b := newBinary()
+	err := b.start("-image", imagePath, "-rootfs", rootfsPath, "-read-only", "bash", "-c", "touch /tmp/foo && ! touch /foo 2> /dev/null")
+	if err != nil {
+		fmt.Println(b.debugInfo())
+		t.Fatal(err)
+	}
+
+	b = newBinary()
+	err = b.start("-image", imagePath, "-rootfs", rootfsPath, "-mask-path", "/proc/cpuinfo", "bash", "-c", "test ! -s /proc/cpuinfo && test ! -s /proc/timer_list")
+	if err != nil {
+		fmt.Println(b.debugInfo())
+		t.Fatal(err)
+	}
+
+	fmt.Println("done")
+}
+
+func Test_secret(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing secrets ... ")
+
+	f, err := ioutil.TempFile("", "psdock_test_secret_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprint(f, "s3cr3t")
+	f.Close()
+
+	b := newBinary()
+	err = b.start("-image", imagePath, "-rootfs", rootfsPath, "-secret", "token="+f.Name(), "bash", "-c", "cat /run/secrets/token && ! touch /run/secrets/foo 2> /dev/null")
+	if err != nil {
+		fmt.Println(b.debugInfo())
+		t.Fatal(err)
+	}
+
+	if string(b.stdout) != "s3cr3t" {
+		t.Fatalf("expected output to be s3cr3t got %q", string(b.stdout))
+	}
+
+	fmt.Println("done")
+}
+
 func Test_webhook(t *testing.T) {
 	beforeTest(t)
 	fmt.Printf("testing web hooks call ... ")
 
 	cpt := 0
-	expectedStatus := []notifier.PsStatus{notifier.StatusStarting, notifier.StatusRunning, notifier.StatusCrashed}
+	expectedStatus := []notifier.PsStatus{notifier.StatusStarting, notifier.StatusRunning, notifier.StatusExited}
 
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
@@ -104,6 +246,619 @@ func Test_webhook(t *testing.T) {
 	fmt.Println("done")
 }
 
+func Test_hooks(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing lifecycle hooks ... ")
+
+	out, err := ioutil.TempFile("", "psdock_test_hooks_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+
+	b := newBinary()
+	err = b.start("-image", imagePath, "-rootfs", rootfsPath,
+		"-pre-start", "echo pre-start >> "+out.Name(),
+		"-post-start", "test -n \"$PSDOCK_PID\" && echo post-start >> "+out.Name(),
+		"-post-stop", "echo post-stop $PSDOCK_EXIT_CODE >> "+out.Name(),
+		"bash", "-c", "exit 2")
+	if exitStatus(err) != 2 {
+		fmt.Println(b.debugInfo())
+		t.Fatalf("expected exit status 2 got %v", err)
+	}
+
+	content, _ := ioutil.ReadFile(out.Name())
+	expected := "pre-start\npost-start\npost-stop 2\n"
+	if string(content) != expected {
+		t.Fatalf("expected hooks output %q got %q", expected, string(content))
+	}
+
+	//failing pre-start hook prevents the process from running
+	b = newBinary()
+	err = b.start("-image", imagePath, "-rootfs", rootfsPath, "-pre-start", "exit 1", "bash", "-c", "echo should not run")
+	if err == nil || strings.Contains(string(b.stdout), "should not run") {
+		fmt.Println(b.debugInfo())
+		t.Fatal("a failing pre-start hook must abort the start")
+	}
+
+	fmt.Println("done")
+}
+
+func Test_restart(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing restart policy ... ")
+
+	var (
+		mutex    sync.Mutex
+		statuses []notifier.PsStatus
+	)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		mutex.Lock()
+		statuses = append(statuses, statusFromHookBody(r.Body, t))
+		mutex.Unlock()
+	}))
+	defer ts.Close()
+
+	b := newBinary()
+	err := b.start("-image", imagePath, "-rootfs", rootfsPath, "-web-hook", ts.URL, "-restart", "on-failure:2", "-restart-delay", "10ms",
+		"bash", "-c", "exit 3")
+	if exitStatus(err) != 3 {
+		fmt.Println(b.debugInfo())
+		t.Fatalf("expected exit status 3 got %v", err)
+	}
+
+	//initial run + 2 restarts
+	if len(statuses) != 9 {
+		t.Fatalf("hook called %d times, should have been called 9 times", len(statuses))
+	}
+	for i, status := range statuses {
+		expected := []notifier.PsStatus{notifier.StatusStarting, notifier.StatusRunning, notifier.StatusCrashed}[i%3]
+		if status != expected {
+			t.Fatalf("expecting status %v got %v", expected, status)
+		}
+	}
+
+	fmt.Println("done")
+}
+
+func Test_healthCheck(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing health checks ... ")
+
+	ch := make(chan notifier.PsStatus, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		ch <- statusFromHookBody(r.Body, t)
+	}))
+	defer ts.Close()
+
+	b := newBinary()
+	go b.start("-image", imagePath, "-rootfs", rootfsPath, "-web-hook", ts.URL, "-health-cmd", "test ! -f /tmp/sick", "-health-interval", "100ms",
+		"-health-retries", "1", "-health-restart", "bash", "-c", "sleep 1 && touch /tmp/sick && sleep 10")
+
+	expectedStatus := []notifier.PsStatus{notifier.StatusStarting, notifier.StatusRunning, notifier.StatusHealthy, notifier.StatusUnhealthy, notifier.StatusCrashed}
+	for _, expected := range expectedStatus {
+		if status := <-ch; status != expected {
+			t.Fatalf("expecting status %v got %v", expected, status)
+		}
+	}
+
+	fmt.Println("done")
+}
+
+func Test_exec(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing exec ... ")
+
+	b := newBinary()
+	go b.start("-image", imagePath, "-rootfs", rootfsPath, "-hostname", "foobar", "tail", "-f", "/dev/null")
+	defer b.stop()
+
+	id := waitContainerID(t)
+
+	e := newBinary()
+	err := e.start("exec", "-e", "FOO=BAR", id, "bash", "-c", "echo $FOO && hostname && exit 4")
+	if exitStatus(err) != 4 {
+		fmt.Println(e.debugInfo())
+		t.Fatalf("expected exit status 4 got %v", err)
+	}
+
+	cleanStdout := strings.Trim(string(e.stdout), "\n")
+	if cleanStdout != "BAR\nfoobar" {
+		t.Fatalf("expected output to be BAR\nfoobar got %s", cleanStdout)
+	}
+
+	fmt.Println("done")
+}
+
+func Test_detachAndAttach(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing detach and attach ... ")
+
+	b := newBinary()
+	if err := b.start("-image", imagePath, "-rootfs", rootfsPath, "-detach", "bash"); err != nil {
+		fmt.Println(b.debugInfo())
+		t.Fatal(err)
+	}
+	id := strings.TrimSpace(string(b.stdout))
+	defer stopContainer(t, id)
+
+	//attach twice, the process must survive the first detach
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("unix", filepath.Join(containersRoot, id, "console.sock"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fmt.Fprintf(conn, "echo attached_$((%d + 1))\n", i)
+		expected := fmt.Sprintf("attached_%d", i+1)
+		if err := waitOutput(conn, expected); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+
+	fmt.Println("done")
+}
+
+func Test_init(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing init ... ")
+
+	// the command is not PID 1 and its exit status is forwarded even if it leaves orphans
+	b := newBinary()
+	err := b.start("-image", imagePath, "-rootfs", rootfsPath, "-init", "bash", "-c", "tr '\\0' ' ' < /proc/1/cmdline; sleep 100 & exit 3")
+	if exitStatus(err) != 3 {
+		fmt.Println(b.debugInfo())
+		t.Fatalf("expected exit status 3 got %v", err)
+	}
+	if !strings.Contains(string(b.stdout), "/dev/init pid1") {
+		t.Fatalf("expected PID 1 to be the init got %q", string(b.stdout))
+	}
+
+	// SIGTERM is forwarded, tail doesn't catch it but is not PID 1 so it is terminated
+	b = newBinary()
+	done := make(chan error)
+	go func() {
+		done <- b.start("-image", imagePath, "-rootfs", rootfsPath, "-init", "tail", "-f", "/dev/null")
+	}()
+	waitContainerID(t)
+	time.Sleep(500 * time.Millisecond)
+	b.stop()
+
+	select {
+	case err := <-done:
+		if exitStatus(err) != 128+15 {
+			fmt.Println(b.debugInfo())
+			t.Fatalf("expected the process to be terminated by SIGTERM got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("process not terminated")
+	}
+	fmt.Println("done")
+}
+
+func Test_procfile(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing procfile ... ")
+
+	f, err := ioutil.TempFile("", "psdock_test_procfile_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	fmt.Fprintln(f, "web: echo web started && sleep 1 && exit 5\nworker: echo $PSDOCK_PROCESS started && sleep 10")
+	f.Close()
+
+	ch := make(chan notifier.PsStatus, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		ch <- statusFromHookBody(r.Body, t)
+	}))
+	defer ts.Close()
+
+	b := newBinary()
+	err = b.start("-image", imagePath, "-rootfs", rootfsPath, "-web-hook", ts.URL, "-procfile", f.Name())
+	if exitStatus(err) != 5 {
+		fmt.Println(b.debugInfo())
+		t.Fatalf("expected exit status 5 got %v", err)
+	}
+
+	//prefixes are colored, escape codes are between the prefix and the line
+	for _, expected := range []string{"web | ", "web started", "worker | ", "worker started"} {
+		if !strings.Contains(string(b.stdout), expected) {
+			t.Fatalf("expected %q in output %q", expected, string(b.stdout))
+		}
+	}
+
+	expectedStatus := []notifier.PsStatus{notifier.StatusStarting, notifier.StatusRunning, notifier.StatusCrashed}
+	for _, expected := range expectedStatus {
+		if status := <-ch; status != expected {
+			t.Fatalf("expecting status %v got %v", expected, status)
+		}
+	}
+
+	fmt.Println("done")
+}
+
+func Test_pauseResume(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing pause and resume ... ")
+
+	ch := make(chan notifier.PsStatus, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		ch <- statusFromHookBody(r.Body, t)
+	}))
+	defer ts.Close()
+
+	b := newBinary()
+	go b.start("-image", imagePath, "-rootfs", rootfsPath, "-web-hook", ts.URL, "tail", "-f", "/dev/null")
+	defer b.stop()
+
+	id := waitContainerID(t)
+	for _, expected := range []notifier.PsStatus{notifier.StatusStarting, notifier.StatusRunning} {
+		if status := <-ch; status != expected {
+			t.Fatalf("expecting status %v got %v", expected, status)
+		}
+	}
+
+	for _, cmd := range []string{"pause", "resume"} {
+		p := newBinary()
+		if err := p.start(cmd, id); err != nil {
+			fmt.Println(p.debugInfo())
+			t.Fatal(err)
+		}
+	}
+
+	for _, expected := range []notifier.PsStatus{notifier.StatusPaused, notifier.StatusRunning} {
+		if status := <-ch; status != expected {
+			t.Fatalf("expecting status %v got %v", expected, status)
+		}
+	}
+
+	fmt.Println("done")
+}
+
+func Test_stats(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing stats ... ")
+
+	b := newBinary()
+	go b.start("-image", imagePath, "-rootfs", rootfsPath, "tail", "-f", "/dev/null")
+	defer b.stop()
+
+	id := waitContainerID(t)
+
+	s := newBinary()
+	if err := s.start("stats", "-format", "json", "-interval", "100ms", "-no-stream", id); err != nil {
+		fmt.Println(s.debugInfo())
+		t.Fatal(err)
+	}
+
+	var stats struct {
+		ID          string `json:"id"`
+		Pids        int    `json:"pids"`
+		MemoryUsage uint64 `json:"memory_usage"`
+	}
+	if err := json.Unmarshal(s.stdout, &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.ID != id || stats.Pids != 1 || stats.MemoryUsage == 0 {
+		t.Fatalf("unexpected stats %s", string(s.stdout))
+	}
+
+	fmt.Println("done")
+}
+
+func Test_controlAPI(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing control api ... ")
+
+	b := newBinary()
+	done := make(chan error)
+	go func() {
+		done <- b.start("-image", imagePath, "-rootfs", rootfsPath, "tail", "-f", "/dev/null")
+	}()
+
+	id := waitContainerID(t)
+	socket := filepath.Join(containersRoot, id, "control.sock")
+	client := &http.Client{Transport: &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get("http://psdock/processes"); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		b.stop()
+		t.Fatal(err)
+	}
+	var processes struct {
+		Pids []int `json:"pids"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&processes)
+	resp.Body.Close()
+	if err != nil || len(processes.Pids) != 1 {
+		b.stop()
+		t.Fatalf("unexpected processes %v: %v", processes.Pids, err)
+	}
+
+	events, err := client.Get("http://psdock/events")
+	if err != nil {
+		b.stop()
+		t.Fatal(err)
+	}
+	defer events.Body.Close()
+
+	resp, err = client.Post("http://psdock/stop?timeout=1s", "", nil)
+	if err != nil {
+		b.stop()
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202 got %d", resp.StatusCode)
+	}
+
+	content, _ := ioutil.ReadAll(events.Body)
+	if !strings.Contains(string(content), `"status":"crashed"`) {
+		t.Fatalf("expected a crashed status in events %q", string(content))
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			fmt.Println(b.debugInfo())
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("container still running after a stop")
+	}
+	fmt.Println("done")
+}
+
+func Test_stopAndKill(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing stop and kill ... ")
+
+	for _, args := range [][]string{{"stop", "-timeout", "2", "-label", "app=web"}, {"kill"}} {
+		b := newBinary()
+		done := make(chan error)
+		go func() {
+			done <- b.start("-image", imagePath, "-rootfs", rootfsPath, "-label", "app=web", "tail", "-f", "/dev/null")
+		}()
+
+		id := waitContainerID(t)
+		if !fileExists(filepath.Join(containersRoot, id, "control.sock")) {
+			time.Sleep(500 * time.Millisecond)
+		}
+		if args[0] == "kill" {
+			args = append(args, id)
+		}
+
+		s := newBinary()
+		if err := s.start(args...); err != nil {
+			fmt.Println(s.debugInfo())
+			b.stop()
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(string(s.stdout)) != id {
+			t.Fatalf("%s: expected %s to be printed got %q", args[0], id, string(s.stdout))
+		}
+
+		// the command returns once the container exited
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("%s: container still running", args[0])
+		}
+		if fileExists(filepath.Join(containersRoot, id, "pid")) {
+			t.Fatalf("%s: container state not removed", args[0])
+		}
+		// not catching SIGTERM, tail is killed
+		if e := readExit(t, id); e.Reason != exitreason.Killed || e.Code != 0 {
+			t.Fatalf("%s: expected the process to be reported as killed got %+v", args[0], e)
+		}
+	}
+	fmt.Println("done")
+}
+
+func Test_name(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing container name ... ")
+
+	b := newBinary()
+	done := make(chan error)
+	go func() {
+		done <- b.start("-image", imagePath, "-rootfs", rootfsPath, "-name", "test-web.1", "tail", "-f", "/dev/null")
+	}()
+
+	if id := waitContainerID(t); id != "test-web.1" {
+		b.stop()
+		t.Fatalf("expected container id test-web.1 got %s", id)
+	}
+
+	// name already in use
+	d := newBinary()
+	err := d.start("-image", imagePath, "-rootfs", rootfsPath+"_2", "-name", "test-web.1", "true")
+	if err == nil || !strings.Contains(string(d.stderr), "already in use") {
+		b.stop()
+		t.Fatalf("expected the name to be rejected, got %v: %s", err, d.debugInfo())
+	}
+
+	// lookup by prefix
+	s := newBinary()
+	if err := s.start("stop", "test-web"); err != nil {
+		fmt.Println(s.debugInfo())
+		b.stop()
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		fmt.Println(b.debugInfo())
+		t.Fatal(err)
+	}
+
+	if err := newBinary().start("-image", imagePath, "-rootfs", rootfsPath, "-name", "../web", "true"); err == nil {
+		t.Fatal("expected an invalid name to be rejected")
+	}
+	fmt.Println("done")
+}
+
+func Test_stopSignal(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing stop signal escalation ... ")
+
+	script := `
+	trap 'echo got term' TERM
+	trap 'echo got quit; exit 3' QUIT
+	while true; do sleep 0.1; done
+	`
+
+	b := newBinary()
+	go func() {
+		waitContainerID(t)
+		time.Sleep(500 * time.Millisecond)
+		b.stop()
+	}()
+
+	startedAt := time.Now()
+	err := b.start("-image", imagePath, "-rootfs", rootfsPath, "-stop-signal", "TERM:1s,QUIT", "bash", "-c", script)
+	if exitStatus(err) != 3 {
+		fmt.Println(b.debugInfo())
+		t.Fatalf("expected exit status 3 got %v", err)
+	}
+	if elapsed := time.Since(startedAt); elapsed < time.Second {
+		t.Fatalf("QUIT sent before the TERM timeout (%v)", elapsed)
+	}
+	if out := string(b.stdout); !strings.Contains(out, "got term") || !strings.Contains(out, "got quit") {
+		t.Fatalf("expected both signals to be received got %q", out)
+	}
+	fmt.Println("done")
+}
+
+func Test_signalMap(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing signal map and scope ... ")
+
+	// the signal must reach the subshell, not only the init
+	script := `
+	(trap 'echo reloaded; exit 4' USR2; while true; do sleep 0.1; done) &
+	wait
+	`
+
+	b := newBinary()
+	go func() {
+		waitContainerID(t)
+		time.Sleep(500 * time.Millisecond)
+		b.ps.Signal(syscall.SIGHUP)
+	}()
+
+	err := b.start("-image", imagePath, "-rootfs", rootfsPath, "-signal-map", "HUP=USR2", "-signal-scope", "all", "bash", "-c", script)
+	if err != nil {
+		fmt.Println(b.debugInfo())
+		t.Fatal(err)
+	}
+	if out := string(b.stdout); !strings.Contains(out, "reloaded") {
+		t.Fatalf("expected the subshell to receive SIGUSR2 got %q", out)
+	}
+	fmt.Println("done")
+}
+
+func Test_exitReason(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing exit reason ... ")
+
+	ch := make(chan notifier.Ps, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload notifier.HookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatal(err)
+		}
+		ch <- *payload.Ps
+	}))
+	defer ts.Close()
+
+	// bash is not PID 1 with -init, it can be killed by its own signal
+	b := newBinary()
+	err := b.start("-image", imagePath, "-rootfs", rootfsPath, "-web-hook", ts.URL, "-name", "exit_reason", "-init", "bash", "-c", "kill -SEGV $$")
+	if exitStatus(err) != 139 {
+		fmt.Println(b.debugInfo())
+		t.Fatalf("expected exit status 139 got %v", err)
+	}
+
+	expected := exitreason.Exit{Reason: exitreason.Signaled, Code: 139, Status: 139, Signal: "SIGSEGV"}
+	for _, status := range []notifier.PsStatus{notifier.StatusStarting, notifier.StatusRunning, notifier.StatusCrashed} {
+		ps := <-ch
+		if ps.Status != status {
+			t.Fatalf("expecting status %v got %v", status, ps.Status)
+		}
+		if status == notifier.StatusCrashed && (ps.Exit == nil || *ps.Exit != expected) {
+			t.Fatalf("expected exit %+v got %+v", expected, ps.Exit)
+		}
+	}
+	if e := readExit(t, "exit_reason"); *e != expected {
+		t.Fatalf("expected exit %+v got %+v", expected, *e)
+	}
+
+	// exiting with 128 + signal number is not being killed
+	b = newBinary()
+	err = b.start("-image", imagePath, "-rootfs", rootfsPath, "-web-hook", ts.URL, "-name", "exit_reason", "-init", "bash", "-c", "exit 139")
+	if exitStatus(err) != 139 {
+		fmt.Println(b.debugInfo())
+		t.Fatalf("expected exit status 139 got %v", err)
+	}
+	expected = exitreason.Exit{Reason: exitreason.Failed, Code: 139, Status: 139}
+	if e := readExit(t, "exit_reason"); *e != expected {
+		t.Fatalf("expected exit %+v got %+v", expected, *e)
+	}
+	for range []notifier.PsStatus{notifier.StatusStarting, notifier.StatusRunning, notifier.StatusCrashed} {
+		<-ch
+	}
+	fmt.Println("done")
+}
+
+func Test_timeout(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing timeout ... ")
+
+	ch := make(chan notifier.PsStatus, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		ch <- statusFromHookBody(r.Body, t)
+	}))
+	defer ts.Close()
+
+	b := newBinary()
+	startedAt := time.Now()
+	err := b.start("-image", imagePath, "-rootfs", rootfsPath, "-web-hook", ts.URL, "-timeout", "1s", "-restart", "always", "tail", "-f", "/dev/null")
+	if exitStatus(err) != 124 {
+		fmt.Println(b.debugInfo())
+		t.Fatalf("expected exit status 124 got %v", err)
+	}
+	if elapsed := time.Since(startedAt); elapsed > 5*time.Second {
+		t.Fatalf("container stopped after %v", elapsed)
+	}
+
+	for _, expected := range []notifier.PsStatus{notifier.StatusStarting, notifier.StatusRunning, notifier.StatusTimedOut, notifier.StatusCrashed} {
+		if status := <-ch; status != expected {
+			t.Fatalf("expecting status %v got %v", expected, status)
+		}
+	}
+	fmt.Println("done")
+}
+
 func Test_remoteStdio(t *testing.T) {
 	beforeTest(t)
 	fmt.Printf("testing remote stdio ... ")
@@ -154,8 +909,8 @@ func Test_remoteStdio(t *testing.T) {
 	conn.Close()
 
 	status = <-ch
-	if status != notifier.StatusCrashed {
-		t.Fatalf("expecting status %v got %v", notifier.StatusCrashed, status)
+	if status != notifier.StatusExited {
+		t.Fatalf("expecting status %v got %v", notifier.StatusExited, status)
 	}
 	fmt.Println("done")
 }
@@ -203,8 +958,189 @@ func Test_bindPort(t *testing.T) {
 	}
 
 	status = <-ch
-	if status != notifier.StatusCrashed {
-		t.Fatalf("expecting status %v got %v", notifier.StatusCrashed, status)
+	if status != notifier.StatusExited {
+		t.Fatalf("expecting status %v got %v", notifier.StatusExited, status)
+	}
+
+	fmt.Println("done")
+}
+
+func Test_stopWhileRestarting(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing stop while waiting for a restart ... ")
+
+	b := newBinary()
+	done := make(chan error)
+	go func() {
+		done <- b.start("-image", imagePath, "-rootfs", rootfsPath, "-name", "restarting", "-label", "app=backoff", "-restart", "always",
+			"-restart-delay", "10s", "bash", "-c", "exit 1")
+	}()
+
+	// the process exited, psdock waits 10s before restarting it
+	waitContainerID(t)
+	time.Sleep(time.Second)
+
+	s := newBinary()
+	if err := s.start("stop", "-label", "app=backoff"); err != nil {
+		fmt.Println(s.debugInfo())
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(s.stdout)) != "restarting" {
+		t.Fatalf("expected restarting to be printed got %q", string(s.stdout))
+	}
+
+	select {
+	case err := <-done:
+		if exitStatus(err) != 1 {
+			t.Fatalf("expected the last exit status 1 got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("container restarted after being stopped")
+	}
+	fmt.Println("done")
+}
+
+func Test_readiness(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing readiness conditions ... ")
+
+	ch := make(chan notifier.PsStatus, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		ch <- statusFromHookBody(r.Body, t)
+	}))
+	defer ts.Close()
+
+	b := newBinary()
+	go b.start("-image", imagePath, "-rootfs", rootfsPath, "-web-hook", ts.URL, "-ready-log", "^worker ready$", "-ready-file", "/tmp/ready",
+		"bash", "-c", "echo worker ready; sleep 1; touch /tmp/ready; sleep 100")
+
+	if status := <-ch; status != notifier.StatusStarting {
+		t.Fatalf("expecting status %v got %v", notifier.StatusStarting, status)
+	}
+	// the log line is not enough, the file must exist too
+	select {
+	case status := <-ch:
+		t.Fatalf("expecting no status change before the file is created got %v", status)
+	case <-time.After(500 * time.Millisecond):
+	}
+	select {
+	case status := <-ch:
+		if status != notifier.StatusRunning {
+			t.Fatalf("expecting status %v got %v", notifier.StatusRunning, status)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("running status not received")
+	}
+	b.stop()
+	<-ch // crashed
+
+	// not ready in time
+	b = newBinary()
+	err := b.start("-image", imagePath, "-rootfs", rootfsPath, "-web-hook", ts.URL, "-ready-file", "/tmp/never",
+		"-startup-timeout", "500ms", "-startup-timeout-action", "restart", "tail", "-f", "/dev/null")
+	if exitStatus(err) != 137 {
+		fmt.Println(b.debugInfo())
+		t.Fatalf("expected the process to be killed, got %v", err)
+	}
+	for _, expected := range []notifier.PsStatus{notifier.StatusStarting, notifier.StatusFailedToStart, notifier.StatusCrashed} {
+		if status := <-ch; status != expected {
+			t.Fatalf("expecting status %v got %v", expected, status)
+		}
+	}
+
+	fmt.Println("done")
+}
+
+func Test_startupTimeout(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing startup timeout ... ")
+
+	ch := make(chan notifier.PsStatus, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		ch <- statusFromHookBody(r.Body, t)
+	}))
+	defer ts.Close()
+
+	// killed and not restarted
+	b := newBinary()
+	err := b.start("-image", imagePath, "-rootfs", rootfsPath, "-web-hook", ts.URL, "-restart", "always", "-ready-file", "/tmp/never",
+		"-startup-timeout", "500ms", "-startup-timeout-action", "kill", "tail", "-f", "/dev/null")
+	if exitStatus(err) != 125 {
+		fmt.Println(b.debugInfo())
+		t.Fatalf("expected exit status 125, got %v", err)
+	}
+	for _, expected := range []notifier.PsStatus{notifier.StatusStarting, notifier.StatusFailedToStart, notifier.StatusCrashed} {
+		if status := <-ch; status != expected {
+			t.Fatalf("expecting status %v got %v", expected, status)
+		}
+	}
+
+	// reported only, ready later
+	b = newBinary()
+	go b.start("-image", imagePath, "-rootfs", rootfsPath, "-web-hook", ts.URL, "-ready-file", "/tmp/ready",
+		"-startup-timeout", "500ms", "bash", "-c", "sleep 1; touch /tmp/ready; sleep 100")
+	defer b.stop()
+
+	for _, expected := range []notifier.PsStatus{notifier.StatusStarting, notifier.StatusFailedToStart, notifier.StatusRunning} {
+		if status := <-ch; status != expected {
+			t.Fatalf("expecting status %v got %v", expected, status)
+		}
+	}
+
+	fmt.Println("done")
+}
+
+func Test_notify(t *testing.T) {
+	beforeTest(t)
+	fmt.Printf("testing notify socket ... ")
+
+	ch := make(chan notifier.Ps, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var payload notifier.HookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Fatal(err)
+		}
+		ch <- *payload.Ps
+	}))
+	defer ts.Close()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm := fmt.Sprintf("%s:/app", filepath.Join(cwd, "assets"))
+
+	b := newBinary()
+	err = b.start("-image", imagePath, "-rootfs", rootfsPath, "-web-hook", ts.URL, "-bind-mount", bm, "-notify", "-watchdog", "1m", "-watchdog-action", "kill",
+		"/app/notify.sh")
+	if err != nil {
+		fmt.Println(b.debugInfo())
+		t.Fatal(err)
+	}
+
+	expected := []notifier.Ps{
+		{Status: notifier.StatusStarting},
+		{Status: notifier.StatusStarting, Message: "booting"},
+		{Status: notifier.StatusRunning},
+		{Status: notifier.StatusCrashed}, // killed by the triggered watchdog
+	}
+	var ps notifier.Ps
+	for _, e := range expected {
+		select {
+		case ps = <-ch:
+			if ps.Status != e.Status || ps.Message != e.Message {
+				t.Fatalf("expecting %+v got %+v", e, ps)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expecting %+v, nothing received", e)
+		}
+	}
+	// killed by psdock itself, not on request
+	if ps.Exit == nil || ps.Exit.Reason != exitreason.Signaled || ps.Exit.Signal != "SIGKILL" || ps.Exit.Code != 137 {
+		t.Fatalf("expected the process to be reported as signaled got %+v", ps.Exit)
 	}
 
 	fmt.Println("done")
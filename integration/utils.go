@@ -5,12 +5,22 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/applidget/psdock/exitreason"
 	"github.com/applidget/psdock/notifier"
 )
 
+const containersRoot = "/run/psdock"
+
 // integration expect to find a ubuntu rootfs in /tmp/image, otherwise they won't be run
 func beforeTest(t *testing.T) {
 	if !fileExists(imagePath) {
@@ -35,3 +45,77 @@ func statusFromHookBody(body io.Reader, t *testing.T) notifier.PsStatus {
 	}
 	return payload.Ps.Status
 }
+
+// exit status of a command error, 0 if no error, -1 if not an exit error
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+	}
+	return -1
+}
+
+// wait for a psdock container to be running and returns its id. Tests are not run in parallel
+// so at most one container is expected to be running
+func waitContainerID(t *testing.T) string {
+	for i := 0; i < 50; i++ {
+		files, _ := ioutil.ReadDir(containersRoot)
+		for _, f := range files {
+			if f.IsDir() && fileExists(filepath.Join(containersRoot, f.Name(), "container", "state.json")) {
+				return f.Name()
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("no running container found")
+	return ""
+}
+
+// send a SIGTERM to the launcher of a container and wait for the container to exit
+func stopContainer(t *testing.T, id string) {
+	dir := filepath.Join(containersRoot, id)
+	b, err := ioutil.ReadFile(filepath.Join(dir, "pid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, _ := strconv.Atoi(string(b))
+	syscall.Kill(pid, syscall.SIGTERM)
+
+	for i := 0; i < 50 && fileExists(filepath.Join(dir, "pid")); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// read conn until the expected string is read (5 seconds timeout)
+func waitOutput(conn net.Conn, expected string) error {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var out []byte
+	buf := make([]byte, 1024)
+	for {
+		n, err := conn.Read(buf)
+		out = append(out, buf[:n]...)
+		if strings.Contains(string(out), expected) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%q not found in output %q: %v", expected, string(out), err)
+		}
+	}
+}
+
+// read the exit status classification written by psdock in the container state directory once it exited
+func readExit(t *testing.T, id string) *exitreason.Exit {
+	b, err := ioutil.ReadFile(filepath.Join(containersRoot, id, "exit.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e exitreason.Exit
+	if err := json.Unmarshal(b, &e); err != nil {
+		t.Fatal(err)
+	}
+	return &e
+}
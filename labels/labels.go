@@ -0,0 +1,40 @@
+package labels
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parse parses key=value labels. A label without value (key) has an empty value
+func Parse(raw []string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, l := range raw {
+		parts := strings.SplitN(l, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		if key == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", l)
+		}
+		if len(parts) == 2 {
+			labels[key] = parts[1]
+		} else {
+			labels[key] = ""
+		}
+	}
+	return labels, nil
+}
+
+// Match tells whether labels match every filter. A filter is either key=value (the label must have this value)
+// or key (the label must be set, whatever its value)
+func Match(labels map[string]string, filters []string) bool {
+	for _, f := range filters {
+		parts := strings.SplitN(f, "=", 2)
+		value, ok := labels[parts[0]]
+		if !ok {
+			return false
+		}
+		if len(parts) == 2 && value != parts[1] {
+			return false
+		}
+	}
+	return true
+}
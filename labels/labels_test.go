@@ -0,0 +1,50 @@
+package labels
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Test_parse(t *testing.T) {
+	fmt.Printf("parse labels ... ")
+
+	labels, err := Parse([]string{"app=web", "tier=front=end", "canary"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"app": "web", "tier": "front=end", "canary": ""}
+	if len(labels) != len(expected) {
+		t.Fatalf("expected %v got %v", expected, labels)
+	}
+	for k, v := range expected {
+		if labels[k] != v {
+			t.Fatalf("expected %s=%s got %s", k, v, labels[k])
+		}
+	}
+
+	if _, err := Parse([]string{"=web"}); err == nil {
+		t.Fatal("a label without key must be rejected")
+	}
+	fmt.Println("done")
+}
+
+func Test_match(t *testing.T) {
+	fmt.Printf("match labels ... ")
+
+	labels := map[string]string{"app": "web", "canary": ""}
+
+	matching := [][]string{nil, {"app"}, {"app=web"}, {"app=web", "canary"}, {"canary="}}
+	for _, filters := range matching {
+		if !Match(labels, filters) {
+			t.Fatalf("%v should match %v", filters, labels)
+		}
+	}
+
+	notMatching := [][]string{{"tier"}, {"app=worker"}, {"app=web", "tier"}, {"app="}}
+	for _, filters := range notMatching {
+		if Match(labels, filters) {
+			t.Fatalf("%v should not match %v", filters, labels)
+		}
+	}
+	fmt.Println("done")
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"github.com/opencontainers/runc/libcontainer/user"
+	"github.com/opencontainers/runc/libcontainer/utils"
+
+	"github.com/applidget/psdock/exitreason"
+	"github.com/applidget/psdock/fsdriver"
+	"github.com/applidget/psdock/notifier"
+	"github.com/applidget/psdock/restart"
+	"github.com/applidget/psdock/stream"
+)
+
+// launcher holds everything shared by the successive runs of the container process
+type launcher struct {
+	c             *cli.Context
+	id            string
+	rootfs        string
+	factory       libcontainer.Factory // created by setup
+	config        *configs.Config
+	secrets       map[string]string
+	labels        map[string]string
+	readyLog      *regexp.Regexp // -ready-log
+	stream        *stream.Stream
+	detached      bool // console served on a unix socket instead of the stream
+	signalHandler *signalHandler
+	paused        pauseState       // see psdock pause
+	timedOut      chan struct{}    // closed once -timeout elapsed
+	exit          *exitreason.Exit // how the last run of the process exited
+}
+
+// setup prepares the state directory of the container, it lives as long as the launcher so that the container
+// can be addressed (psdock stop, control API ...) while its process is waiting for a restart
+func (l *launcher) setup() error {
+	// creates the state directory
+	factory, err := newFactory(l.id)
+	if err != nil {
+		return err
+	}
+	l.factory = factory
+	dir := filepath.Join(containersRoot, l.id)
+
+	if l.detached {
+		if err := redirectOutput(filepath.Join(dir, detachedLog)); err != nil {
+			return err
+		}
+	}
+
+	//write PID of launching process
+	if err := ioutil.WriteFile(filepath.Join(dir, pidFile), []byte(fmt.Sprintf("%d", os.Getpid())), 0600); err != nil {
+		return err
+	}
+
+	if err := writeLabels(l.id, l.labels); err != nil {
+		return err
+	}
+
+	if err := l.serveControl(); err != nil {
+		return err
+	}
+
+	if len(l.secrets) > 0 {
+		execUser, err := user.GetExecUserPath(l.c.String("user"), nil, filepath.Join(l.rootfs, "etc", "passwd"), filepath.Join(l.rootfs, "etc", "group"))
+		if err != nil {
+			return err
+		}
+		if err := mountSecrets(filepath.Join(dir, secretsDir), l.secrets, execUser.Uid, execUser.Gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// teardown removes the state directory, it can be called after a partial setup
+func (l *launcher) teardown() {
+	closeControl()
+	if len(l.secrets) > 0 {
+		// must be unmounted before the container state directory is removed
+		unmountSecrets(filepath.Join(containersRoot, l.id, secretsDir))
+	}
+	// the log of a detached launcher is kept along with the exit status, until the name is reused. The pid file
+	// is removed last, the state directory is considered stale as long as it exists (see exitedContainer)
+	dir := filepath.Join(containersRoot, l.id)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, entry := range entries {
+		if entry.Name() == detachedLog || entry.Name() == pidFile {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			log.Error(err)
+		}
+	}
+	os.Remove(filepath.Join(dir, pidFile))
+	os.Remove(dir) // if empty
+}
+
+// run creates the container, runs the process until it exits and destroys the container.
+// It returns the process exit status
+func (l *launcher) run() (int, error) {
+	c := l.c
+
+	container, err := l.factory.Create(containerDir, l.config)
+	if err != nil {
+		return 1, err
+	}
+	defer container.Destroy()
+
+	// the socket must exist before the container is started to be bind mounted
+	var notify *notifyServer
+	if c.Bool("notify") {
+		if notify, err = l.listenNotify(); err != nil {
+			return 1, err
+		}
+		defer notify.Close()
+	}
+
+	// prepare process
+	env, err := loadEnv(l.id, c)
+	if err != nil {
+		return 1, err
+	}
+	args := []string(c.Args())
+	if c.Bool("init") {
+		// -- so that the command flags are not parsed by the pid1 command
+		args = append([]string{initPath, "pid1", "--"}, args...)
+		if err := resetInitStatus(l.id); err != nil {
+			return 1, err
+		}
+	}
+	process := &libcontainer.Process{
+		Args: args,
+		Env:  env,
+		User: c.String("user"),
+		Cwd:  c.String("cwd"),
+	}
+
+	var tty *tty
+	if l.detached {
+		rootuid, err := l.config.HostUID()
+		if err != nil {
+			return 1, err
+		}
+
+		tty, err = newTty(process, rootuid)
+		if err != nil {
+			return 1, err
+		}
+		defer tty.Close()
+
+		var output io.Writer // only kept for attached clients without -stdio
+		if c.String("stdio") != "" {
+			output = l.stream
+		}
+		server, err := serveConsole(tty.console, filepath.Join(containersRoot, l.id, consoleSocket), output)
+		if err != nil {
+			return 1, err
+		}
+		defer server.Close()
+	} else if !l.stream.Interactive() {
+		//no tty
+		process.Stdin = nil
+		process.Stdout = l.stream
+		process.Stderr = l.stream
+	} else {
+		rootuid, err := l.config.HostUID()
+		if err != nil {
+			return 1, err
+		}
+
+		tty, err = newTty(process, rootuid)
+		if err != nil {
+			return 1, err
+		}
+
+		if err := tty.attach(l.stream); err != nil {
+			return 1, err
+		}
+		tty.resize()
+
+		defer tty.Close()
+	}
+
+	checker := newHealthChecker(c, container, env)
+
+	l.signalHandler.setProcess(container, process, tty)
+	defer l.signalHandler.setProcess(nil, nil, nil)
+
+	// start container process
+	statusChanged(c, notifier.StatusStarting)
+	var result *exitreason.Exit // nil if the process couldn't be run
+	defer func() { l.reportExit(result) }()
+
+	hookEnv := &hookEnv{id: l.id, rootfs: l.rootfs, exitCode: -1}
+	if err := runHooks(c, preStart, hookEnv); err != nil {
+		return 1, err
+	}
+	if l.signalHandler.stopRequested() {
+		// stopped while the pre-start hooks ran, the stop signal reached no process: don't start it
+		log.Info("stopped before the process started, not starting it")
+		result = l.classifyExit(exitreason.Facts{})
+		return result.Code, nil
+	}
+
+	// output is watched before the process is started not to miss the line
+	var reported []<-chan struct{} // closed once the process reported it is ready
+	if l.readyLog != nil {
+		matched, cancel := l.stream.Watch(l.readyLog)
+		defer cancel()
+		reported = append(reported, matched)
+	}
+	if notify != nil {
+		reported = append(reported, notify.ready)
+	}
+
+	// start the container
+	if err := container.Start(process); err != nil {
+		return 1, err
+	}
+	defer func() { runPostStop(c, hookEnv, result) }()
+	oom := watchOOM(container)
+
+	hookEnv.pid, _ = process.Pid()
+	if err := runHooks(c, postStart, hookEnv); err != nil {
+		log.Errorf("%v, killing the process", err)
+		process.Signal(syscall.SIGKILL)
+	}
+
+	// health probes run in the container, they must be over before it is destroyed
+	var probes sync.WaitGroup
+	exited := make(chan struct{})
+	defer func() {
+		close(exited)
+		probes.Wait()
+	}()
+
+	if checker != nil {
+		probes.Add(1)
+		go func() {
+			defer probes.Done()
+			watchHealth(c, checker, process, exited)
+		}()
+	}
+
+	if notify != nil && c.Duration("watchdog") > 0 {
+		go l.watchWatchdog(notify, process, exited)
+	}
+
+	failedToStart := make(chan struct{})
+	go l.waitReady(container, process, reported, failedToStart, exited)
+
+	// container exited
+	status, err := waitStatus(process)
+	outcome := l.signalHandler.processExited()
+	if err != nil {
+		return 1, err
+	}
+
+	if c.Bool("init") {
+		// psdock init exits with the exit status of the command, its wait status tells whether it was killed
+		if initStatus, ok := readInitStatus(l.id); ok {
+			status = initStatus
+		}
+	}
+
+	facts := exitreason.Facts{Status: utils.ExitStatus(status), Forced: outcome.Forced, Requested: outcome.Requested}
+	if status.Signaled() {
+		facts.Signal = status.Signal()
+	}
+	facts.OOM = oom.oomKilled(facts.Status != 0)
+	select {
+	case <-failedToStart:
+		facts.FailedToStart = true
+	default:
+	}
+	result = l.classifyExit(facts)
+
+	return result.Code, nil
+}
+
+// runRestarting runs the process until it exits and won't be restarted according to policy or psdock is stopped,
+// it returns the last exit status
+func (l *launcher) runRestarting(policy *restart.Policy, driver fsdriver.Driver) (int, error) {
+	backoff := 0 // consecutive quick restarts, resets when the process ran for a while
+	for restarts := 0; ; restarts++ {
+		startedAt := time.Now()
+		exit, err := l.run()
+		if err != nil {
+			return 1, err
+		}
+
+		if l.signalHandler.stopRequested() || !policy.ShouldRestart(exit, restarts) {
+			return exit, nil
+		}
+
+		if time.Since(startedAt) > policy.MaxDelay {
+			backoff = 0
+		}
+		delay := policy.Backoff(backoff)
+		backoff++
+		log.Infof("process exited with status %d, restarting in %v", exit, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-l.signalHandler.stopCh:
+			return exit, nil
+		}
+
+		if l.c.Bool("restart-fresh-rootfs") {
+			if err := driver.CleanupRootfs(); err != nil {
+				return 1, err
+			}
+			if err := setupRootfs(driver, l.rootfs, l.c); err != nil {
+				return 1, err
+			}
+		}
+	}
+}
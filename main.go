@@ -2,34 +2,53 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sync"
 	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 	"github.com/opencontainers/runc/libcontainer"
-	"github.com/opencontainers/runc/libcontainer/utils"
 
+	"github.com/applidget/psdock/control"
+	"github.com/applidget/psdock/exitreason"
 	"github.com/applidget/psdock/fsdriver"
+	"github.com/applidget/psdock/labels"
 	"github.com/applidget/psdock/logrotate"
 	"github.com/applidget/psdock/notifier"
+	"github.com/applidget/psdock/procfile"
+	"github.com/applidget/psdock/ready"
+	"github.com/applidget/psdock/restart"
+	"github.com/applidget/psdock/shutdown"
 	"github.com/applidget/psdock/stream"
 	"github.com/applidget/psdock/system"
 )
 
 const (
 	containersRoot = "/run/psdock"
+
+	// the libcontainer container lives in this sub directory of the state directory, it is destroyed after each run
+	// of the process while the state directory lives as long as psdock
+	containerDir = "container"
+
+	pidFile = "pid" // pid of the psdock process running a container, in its state directory
 )
 
 var (
+	statusMutex sync.Mutex
+	lastStatus  notifier.PsStatus // current process status, see statusChanged
+
+	controlServer *control.Server // control API of the current container, status changes are published to it
+	hooks         *notifier.Queue // web-hook deliveries, outside of statusMutex
+
 	version     string // this variable is populated by the makefile
-	standardEnv = &cli.StringSlice{
+	standardEnv = []string{
 		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
 		"TERM=xterm",
 	}
@@ -44,17 +63,65 @@ func main() {
 	app.Flags = []cli.Flag{
 		cli.StringFlag{Name: "image, i", Usage: "container image"},
 		cli.StringFlag{Name: "rootfs, r", Usage: "container rootfs"},
+		cli.StringFlag{Name: "name", Usage: "container name used as its id, must be unique among running containers (defaults to a random psdock_xxxxxxx)"},
 		cli.StringFlag{Name: "stdio", Usage: "standard input/output, if not specified, will use current stdin and stdout"},
+		cli.BoolFlag{Name: "init", Usage: "run a psdock init as PID 1 that spawns the process, reaps orphaned processes and forwards signals"},
+		cli.BoolFlag{Name: "detach, d", Usage: "run the container in the background, use psdock attach to access its console"},
+		cli.StringSliceFlag{Name: "label", Value: &cli.StringSlice{}, Usage: "set metadata on the container, used to select it in psdock stop and psdock kill (format: key=value)"},
 		cli.StringFlag{Name: "stdout-prefix", Usage: "add a prefix to container output lines (format: <prefix>:<color>)"},
 		cli.StringFlag{Name: "web-hook", Usage: "web hook to notify process status changes"},
 		cli.StringFlag{Name: "bind-port", Usage: "port the process is expected to bind"},
+		cli.StringFlag{Name: "ready-log", Usage: "regular expression matching a line of the process output once it is ready"},
+		cli.StringFlag{Name: "ready-file", Usage: "path of a file created in the container once the process is ready"},
+		cli.StringFlag{Name: "ready-require", Value: "all", Usage: "readiness conditions (-bind-port, -ready-log, -ready-file, -notify) required to be running (all|any)"},
+		cli.DurationFlag{Name: "startup-timeout", Usage: "report the failed_to_start status if the process is not ready after this timeout"},
+		cli.StringFlag{Name: "startup-timeout-action", Value: "report", Usage: "what to do when the startup timeout expires (report|restart|kill)"},
+		cli.BoolFlag{Name: "notify", Usage: "the process reports its state using the sd_notify protocol (NOTIFY_SOCKET), it is running once it sent READY=1"},
+		cli.DurationFlag{Name: "watchdog", Usage: "with -notify, expect the process to send WATCHDOG=1 at least once per period (WATCHDOG_USEC)"},
+		cli.StringFlag{Name: "watchdog-action", Value: "restart", Usage: "what to do when the watchdog expires (restart|kill)"},
 		cli.StringFlag{Name: "user, u", Value: "root", Usage: "user inside container"},
 		cli.StringFlag{Name: "cwd", Usage: "set the current working dir"},
 		cli.StringFlag{Name: "hostname", Value: "psdock", Usage: "set the container hostname"},
-		cli.StringSliceFlag{Name: "env, e", Value: standardEnv, Usage: "set environment variables for the process"},
+		cli.StringSliceFlag{Name: "add-host", Value: &cli.StringSlice{}, Usage: "add an entry to the container /etc/hosts (format: name:ip)"},
+		cli.StringSliceFlag{Name: "dns", Value: &cli.StringSlice{}, Usage: "set a nameserver in the container resolv.conf instead of using the host one"},
+		cli.StringSliceFlag{Name: "dns-search", Value: &cli.StringSlice{}, Usage: "set a search domain in the container resolv.conf"},
+		cli.StringSliceFlag{Name: "dns-option", Value: &cli.StringSlice{}, Usage: "set an option in the container resolv.conf"},
+		cli.StringSliceFlag{Name: "env, e", Value: &cli.StringSlice{}, Usage: "set environment variables for the process"},
+		cli.StringSliceFlag{Name: "env-file", Value: &cli.StringSlice{}, Usage: "read environment variables from a dotenv file"},
+		cli.StringSliceFlag{Name: "env-inherit", Value: &cli.StringSlice{}, Usage: "copy host environment variables matching the pattern (ex: AWS_*)"},
+		cli.StringSliceFlag{Name: "secret", Value: &cli.StringSlice{}, Usage: "make a host file available in /run/secrets (format: name=/path/on/host)"},
 		cli.StringSliceFlag{Name: "bind-mount", Value: &cli.StringSlice{}, Usage: "set bind mounts"},
+		cli.StringSliceFlag{Name: "device", Value: &cli.StringSlice{}, Usage: "add a host device to the container (format: /dev/host[:/dev/container][:rwm])"},
+		cli.BoolFlag{Name: "read-only", Usage: "mount the container rootfs read only (/tmp and /run are writable tmpfs)"},
+		cli.StringSliceFlag{Name: "mask-path", Value: &cli.StringSlice{}, Usage: "mask a path inside the container (\"none\" drops default masked paths)"},
+		cli.StringSliceFlag{Name: "readonly-path", Value: &cli.StringSlice{}, Usage: "mount a path read only inside the container (\"none\" drops default read only paths)"},
+		cli.StringSliceFlag{Name: "sysctl", Value: &cli.StringSlice{}, Usage: "set a namespaced kernel parameter (format: key=value)"},
 		cli.IntFlag{Name: "log-rotate", Usage: "rotate stdout output (if stdio is a proper file)"},
+		cli.StringFlag{Name: "stop-signal", Usage: "signal (QUIT) or escalation chain (TERM:10s,INT:5s,KILL) used to stop the process, defaults to the received SIGINT or SIGTERM"},
+		cli.StringSliceFlag{Name: "signal-map", Value: &cli.StringSlice{}, Usage: "deliver a received signal as another one (format: HUP=USR2), can be specified multiple times"},
+		cli.StringFlag{Name: "signal-scope", Value: "init", Usage: "processes receiving the signals (init|group|all)"},
 		cli.IntFlag{Name: "kill-timeout", Value: -1, Usage: "kill the process after timeout after receiving a SIGINT or SIGTERM"},
+		cli.DurationFlag{Name: "timeout", Usage: "stop the container once this duration elapsed since start (restarts included)"},
+		cli.StringFlag{Name: "health-cmd", Usage: "command run inside the container to check the process health"},
+		cli.StringFlag{Name: "health-http", Usage: "url expected to answer a 2xx status code to a GET when the process is healthy"},
+		cli.StringFlag{Name: "health-tcp", Usage: "address (host:port) expected to accept connections when the process is healthy"},
+		cli.DurationFlag{Name: "health-interval", Value: 30 * time.Second, Usage: "delay between two health checks"},
+		cli.DurationFlag{Name: "health-timeout", Value: 10 * time.Second, Usage: "health check timeout"},
+		cli.IntFlag{Name: "health-retries", Value: 3, Usage: "consecutive failures needed to consider the process unhealthy"},
+		cli.DurationFlag{Name: "health-start-period", Usage: "failures during this period after start are not counted"},
+		cli.BoolFlag{Name: "health-restart", Usage: "kill the process when it becomes unhealthy (restart policy then applies)"},
+		cli.StringSliceFlag{Name: "pre-start", Value: &cli.StringSlice{}, Usage: "host command run before the process is started"},
+		cli.StringSliceFlag{Name: "post-start", Value: &cli.StringSlice{}, Usage: "host command run once the process is started"},
+		cli.StringSliceFlag{Name: "post-stop", Value: &cli.StringSlice{}, Usage: "host command run once the process exited"},
+		cli.StringSliceFlag{Name: "prestart-hook", Value: &cli.StringSlice{}, Usage: "command run once the container namespaces are created, before the process is started"},
+		cli.DurationFlag{Name: "hook-timeout", Value: 30 * time.Second, Usage: "kill host hooks still running after this timeout"},
+		cli.StringFlag{Name: "hook-failure", Value: "abort", Usage: "what to do when a pre-start or post-start hook fails (abort|ignore)"},
+		cli.StringFlag{Name: "procfile", Usage: "run every process of the Procfile in the container"},
+		cli.StringSliceFlag{Name: "procfile-optional", Value: &cli.StringSlice{}, Usage: "procfile process that doesn't stop the container when it exits"},
+		cli.StringFlag{Name: "restart", Value: "no", Usage: "restart policy when the process exits (format: no|on-failure[:max-retries]|always)"},
+		cli.DurationFlag{Name: "restart-delay", Value: time.Second, Usage: "delay before the first restart, doubled on each restart"},
+		cli.DurationFlag{Name: "restart-max-delay", Value: time.Minute, Usage: "maximum delay between two restarts"},
+		cli.BoolFlag{Name: "restart-fresh-rootfs", Usage: "start each restart with a fresh copy of the image"},
 	}
 	app.Commands = []cli.Command{
 		cli.Command{
@@ -62,6 +129,100 @@ func main() {
 			Usage:  "container init, should never be invoked manually",
 			Action: initAction,
 		},
+		cli.Command{
+			Name:   "pid1",
+			Usage:  "container pid 1 when running a procfile, should never be invoked manually",
+			Action: pid1Action,
+		},
+		cli.Command{
+			Name:  "attach",
+			Usage: "attach to the console of a detached container: psdock attach [OPTIONS] <container-id>",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "detach-keys", Value: defaultDetachKeys, Usage: "key sequence to detach from the container"},
+			},
+			Action: func(c *cli.Context) {
+				if err := attachAction(c); err != nil {
+					log.Fatal(err)
+				}
+			},
+		},
+		cli.Command{
+			Name:  "pause",
+			Usage: "freeze every process of a running container: psdock pause <container-id>",
+			Action: func(c *cli.Context) {
+				if err := pauseAction(c, true); err != nil {
+					log.Fatal(err)
+				}
+			},
+		},
+		cli.Command{
+			Name:  "resume",
+			Usage: "thaw every process of a paused container: psdock resume <container-id>",
+			Action: func(c *cli.Context) {
+				if err := pauseAction(c, false); err != nil {
+					log.Fatal(err)
+				}
+			},
+		},
+		cli.Command{
+			Name:  "stats",
+			Usage: "display resource usage of running containers: psdock stats [OPTIONS] [container-id...]",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "format", Value: "table", Usage: "output format (table|json)"},
+				cli.DurationFlag{Name: "interval", Value: time.Second, Usage: "refresh interval, rates are computed over it"},
+				cli.BoolFlag{Name: "no-stream", Usage: "display stats once and exit"},
+			},
+			Action: func(c *cli.Context) {
+				if err := statsAction(c); err != nil {
+					log.Fatal(err)
+				}
+			},
+		},
+		cli.Command{
+			Name:  "stop",
+			Usage: "gracefully stop containers and wait for them to exit: psdock stop [OPTIONS] [container-id...]",
+			Flags: []cli.Flag{
+				cli.IntFlag{Name: "timeout", Value: -1, Usage: "kill the process after timeout seconds (defaults to the container -kill-timeout)"},
+				cli.BoolFlag{Name: "all, a", Usage: "stop every running container"},
+				cli.StringSliceFlag{Name: "label", Value: &cli.StringSlice{}, Usage: "stop running containers having this label (format: key or key=value)"},
+			},
+			Action: func(c *cli.Context) {
+				if err := stopAction(c); err != nil {
+					log.Fatal(err)
+				}
+			},
+		},
+		cli.Command{
+			Name:  "kill",
+			Usage: "send a signal to the process of containers: psdock kill [OPTIONS] [container-id...]",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "signal, s", Value: "KILL", Usage: "signal to send (name or number)"},
+				cli.BoolFlag{Name: "all, a", Usage: "signal every running container"},
+				cli.StringSliceFlag{Name: "label", Value: &cli.StringSlice{}, Usage: "signal running containers having this label (format: key or key=value)"},
+			},
+			Action: func(c *cli.Context) {
+				if err := killAction(c); err != nil {
+					log.Fatal(err)
+				}
+			},
+		},
+		cli.Command{
+			Name:  "exec",
+			Usage: "run a command in a running container: psdock exec [OPTIONS] <container-id> command",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "tty, t", Usage: "allocate a tty"},
+				cli.StringFlag{Name: "user, u", Value: "root", Usage: "user inside container"},
+				cli.StringFlag{Name: "cwd", Usage: "set the current working dir"},
+				cli.StringSliceFlag{Name: "env, e", Value: &cli.StringSlice{}, Usage: "set environment variables for the process"},
+			},
+			Action: func(c *cli.Context) {
+				exit, err := execAction(c)
+				if err != nil {
+					log.Fatal(err)
+				}
+				os.Exit(exit)
+			},
+		},
 	}
 	app.Action = func(c *cli.Context) {
 		exit, err := start(c)
@@ -91,6 +252,102 @@ func initAction(c *cli.Context) {
 }
 
 func start(c *cli.Context) (int, error) {
+	if hf := c.String("hook-failure"); hf != "abort" && hf != "ignore" {
+		return 1, fmt.Errorf("invalid hook failure policy %s", hf)
+	}
+
+	// the detached launcher is given its container id by the one that spawned it
+	cuid := os.Getenv(detachedIDEnv)
+	detached := cuid != ""
+	if c.Bool("detach") && !detached {
+		return detach(c)
+	}
+	os.Unsetenv(detachedIDEnv)
+
+	// statuses are sent in order, the last ones before psdock exits
+	if wh := c.String("web-hook"); wh != "" {
+		notifier.WebHook = wh
+		hooks = notifier.NewQueue(func(ps *notifier.Ps) {
+			if err := notifier.NotifyHook(ps); err != nil {
+				log.Errorf("failed to notify web-hook %s: %v", wh, err)
+			}
+		})
+		defer hooks.Close()
+	}
+
+	if cuid == "" {
+		var err error
+		if cuid, err = newContainerID(c); err != nil {
+			return 1, err
+		}
+	}
+
+	lock, err := reserveID(cuid)
+	if err != nil {
+		return 1, err
+	}
+	defer lock.Release()
+
+	policy, err := restart.ParsePolicy(c.String("restart"))
+	if err != nil {
+		return 1, err
+	}
+	policy.Delay, policy.MaxDelay = c.Duration("restart-delay"), c.Duration("restart-max-delay")
+
+	containerLabels, err := labels.Parse(c.StringSlice("label"))
+	if err != nil {
+		return 1, err
+	}
+
+	if _, err := ready.ParseMode(c.String("ready-require")); err != nil {
+		return 1, err
+	}
+	if sa := c.String("startup-timeout-action"); sa != "report" && sa != "restart" && sa != "kill" {
+		return 1, fmt.Errorf("invalid startup timeout action %s, expected report, restart or kill", sa)
+	}
+	if wa := c.String("watchdog-action"); wa != "restart" && wa != "kill" {
+		return 1, fmt.Errorf("invalid watchdog action %s, expected restart or kill", wa)
+	}
+	if c.Duration("watchdog") > 0 && !c.Bool("notify") {
+		return 1, fmt.Errorf("-watchdog requires -notify")
+	}
+	var stopChain []shutdown.Step
+	if c.String("stop-signal") != "" {
+		if stopChain, err = shutdown.ParseChain(c.String("stop-signal")); err != nil {
+			return 1, fmt.Errorf("invalid -stop-signal: %v", err)
+		}
+	}
+	signalMap, err := system.ParseSignalMap(c.StringSlice("signal-map"))
+	if err != nil {
+		return 1, fmt.Errorf("invalid -signal-map: %v", err)
+	}
+	if ss := c.String("signal-scope"); ss != scopeInit && ss != scopeGroup && ss != scopeAll {
+		return 1, fmt.Errorf("invalid signal scope %s, expected init, group or all", ss)
+	}
+	if err := checkHealthFlags(c); err != nil {
+		return 1, err
+	}
+	var readyLog *regexp.Regexp
+	if c.String("ready-log") != "" {
+		if detached {
+			// the output is not written to the stream
+			return 1, fmt.Errorf("-ready-log can't be used with -detach")
+		}
+		if readyLog, err = regexp.Compile(c.String("ready-log")); err != nil {
+			return 1, fmt.Errorf("invalid -ready-log: %v", err)
+		}
+	}
+
+	var entries []procfile.Entry
+	if c.String("procfile") != "" {
+		if entries, err = loadProcfile(c); err != nil {
+			return 1, err
+		}
+	}
+	if c.Bool("init") && entries == nil && len(c.Args()) == 0 {
+		return 1, fmt.Errorf("no command specified")
+	}
+
 	// setup rootfs
 	image := c.String("image")
 	if image == "" {
@@ -109,48 +366,22 @@ func start(c *cli.Context) (int, error) {
 		return 1, err
 	}
 
-	if err := driver.SetupRootfs(); err != nil {
+	if err := setupRootfs(driver, rootfs, c); err != nil {
 		return 1, err
 	}
 	defer driver.CleanupRootfs()
 
-	// create container factory
-	bin, err := exec.LookPath("psdock")
-	if err != nil {
-		//psdock not in the path
-		bin, _ = filepath.Abs(os.Args[0])
-	}
-	factory, err := libcontainer.New(containersRoot, libcontainer.InitArgs(bin, "init"), libcontainer.Cgroupfs)
+	secrets, err := parseSecrets(c.StringSlice("secret"))
 	if err != nil {
 		return 1, err
 	}
 
-	// create container
-	cuid, _ := utils.GenerateRandomName("psdock_", 7)
-	config, err := loadConfig(cuid, rootfs, c.String("hostname"), c.StringSlice("bind-mount"))
+	// load container config
+	config, err := loadConfig(cuid, rootfs, c)
 	if err != nil {
 		return 1, err
 	}
 
-	container, err := factory.Create(cuid, config)
-	if err != nil {
-		return 1, err
-	}
-	defer container.Destroy()
-
-	//write PID of launching process, it will be next to the state.json file
-	if err := ioutil.WriteFile(filepath.Join(containersRoot, cuid, "pid"), []byte(fmt.Sprintf("%d", os.Getpid())), 0600); err != nil {
-		return 1, err
-	}
-
-	// prepare process
-	process := &libcontainer.Process{
-		Args: c.Args(),
-		Env:  c.StringSlice("env"),
-		User: c.String("user"),
-		Cwd:  c.String("cwd"),
-	}
-
 	// prepare stdio stream
 	pref, prefColor := parsePrefixArg(c.String("stdout-prefix"))
 	s, err := stream.NewStream(c.String("stdio"), pref, prefColor)
@@ -159,29 +390,17 @@ func start(c *cli.Context) (int, error) {
 	}
 	defer s.Close()
 
-	var tty *tty
-	if !s.Interactive() {
-		//no tty
-		process.Stdin = nil
-		process.Stdout = s
-		process.Stderr = s
-	} else {
-		rootuid, err := config.HostUID()
-		if err != nil {
-			return 1, err
-		}
-
-		tty, err = newTty(process, rootuid)
-		if err != nil {
-			return 1, err
-		}
+	if detached && s.Interactive() {
+		return 1, fmt.Errorf("detached containers can't use an interactive stdio, use psdock attach")
+	}
 
-		if err := tty.attach(s); err != nil {
-			return 1, err
-		}
-		tty.resize()
+	if entries != nil && (detached || s.Interactive()) {
+		return 1, fmt.Errorf("-procfile can't be used with -detach or an interactive stdio")
+	}
 
-		defer tty.Close()
+	if s.Interactive() && policy.Mode != restart.No {
+		// the stream is closed with the tty of the first process
+		return 1, fmt.Errorf("restart policies are not supported with an interactive stdio")
 	}
 
 	//setup log rotation if wanted
@@ -193,7 +412,9 @@ func start(c *cli.Context) (int, error) {
 	}
 
 	// forward received signals to container process
-	signalHandler := &signalHandler{process: process, tty: tty, killTimeout: c.Int("kill-timeout")}
+	signalHandler := newSignalHandler(stopChain, time.Duration(c.Int("kill-timeout"))*time.Second)
+	signalHandler.forwardsAll = c.Bool("init") || entries != nil
+	signalHandler.signalMap, signalHandler.scope = signalMap, c.String("signal-scope")
 	go signalHandler.startCatching()
 
 	if s.Interactive() {
@@ -204,75 +425,160 @@ func start(c *cli.Context) (int, error) {
 		}()
 	}
 
-	// start container process
-	statusChanged(c, notifier.StatusStarting)
-	defer statusChanged(c, notifier.StatusCrashed)
+	l := &launcher{
+		c:             c,
+		id:            cuid,
+		rootfs:        rootfs,
+		config:        config,
+		secrets:       secrets,
+		labels:        containerLabels,
+		readyLog:      readyLog,
+		stream:        s,
+		detached:      detached,
+		signalHandler: signalHandler,
+		timedOut:      make(chan struct{}),
+	}
 
-	// start the container
-	if err := container.Start(process); err != nil {
-		return 1, err
+	// wall clock timeout of the whole run, restarts included
+	var timer *time.Timer
+	if timeout := c.Duration("timeout"); timeout > 0 {
+		timer = time.AfterFunc(timeout, func() {
+			close(l.timedOut)
+			log.Errorf("timeout of %v elapsed, stopping the container", timeout)
+			statusChanged(c, notifier.StatusTimedOut)
+			signalHandler.terminate(nil, -1)
+		})
 	}
 
-	if c.String("bind-port") == "" {
-		statusChanged(c, notifier.StatusRunning)
-	} else {
-		go func() {
-			port := c.String("bind-port")
-			for {
-				//
-				pids, err := container.Processes()
-				if err != nil {
-					log.Errorf("failed to get back container processes: %v", err)
-					// if this arise, we just do not change process status
-					return
-				}
+	var exit int
+	if err = l.setup(); err == nil {
+		if entries != nil {
+			exit, err = l.runProcfile(entries, policy)
+		} else {
+			exit, err = l.runRestarting(policy, driver)
+		}
+	}
 
-				bound, err := system.IsPortBound(port, pids)
-				if err != nil || !bound {
-					if err != nil {
-						log.Errorf("failed to check if port %s is bound: %v", port, err)
-					}
-					//will retry
-					time.Sleep(200 * time.Millisecond)
-				} else {
-					break
-				}
-			}
+	if timer != nil {
+		timer.Stop()
+	}
+	l.teardown()
+	if err != nil || l.exit == nil {
+		return exit, err
+	}
 
-			statusChanged(c, notifier.StatusRunning)
-		}()
+	e := *l.exit
+	select {
+	case <-l.timedOut:
+		// the last run may have ended before, the timeout elapsed while waiting for a restart
+		e.Reason, e.Code = exitreason.TimedOut, exitreason.CodeTimedOut
+	default:
+	}
+	if err := writeExit(cuid, &e); err != nil {
+		log.Errorf("failed to write the exit status: %v", err)
 	}
+	return e.Code, nil
+}
 
-	// container exited
-	status, err := process.Wait()
+// create the factory of a container, rooted in its state directory
+func newFactory(id string) (libcontainer.Factory, error) {
+	return libcontainer.New(filepath.Join(containersRoot, id), libcontainer.InitArgs(psdockBinary(), "init"), libcontainer.Cgroupfs)
+}
 
+// load the libcontainer container of a running process
+func loadContainer(id string) (libcontainer.Container, error) {
+	factory, err := newFactory(id)
 	if err != nil {
-		exitError, ok := err.(*exec.ExitError)
-		if ok {
-			status = exitError.ProcessState
-		} else {
-			return 1, err
+		return nil, err
+	}
+	container, err := factory.Load(containerDir)
+	if err != nil {
+		return nil, fmt.Errorf("process of container %s not running: %v", id, err)
+	}
+	return container, nil
+}
+
+func psdockBinary() string {
+	bin, err := exec.LookPath("psdock")
+	if err != nil {
+		//psdock not in the path
+		bin, _ = filepath.Abs(os.Args[0])
+	}
+	return bin
+}
+
+// load procfile entries and make sure no incompatible flag is given
+func loadProcfile(c *cli.Context) ([]procfile.Entry, error) {
+	if len(c.Args()) > 0 {
+		return nil, fmt.Errorf("no command can be given with -procfile")
+	}
+	for _, flag := range []string{"bind-port", "ready-log", "ready-file", "health-cmd", "health-http", "health-tcp"} {
+		if c.String(flag) != "" {
+			return nil, fmt.Errorf("-%s is not supported with -procfile", flag)
 		}
 	}
+	if c.Bool("notify") {
+		return nil, fmt.Errorf("-notify is not supported with -procfile")
+	}
 
-	exit := utils.ExitStatus(status.Sys().(syscall.WaitStatus))
-	if signalHandler.forceKilled && exit == 137 { //128 + 9 (kill) indicates a kill exit status
-		//sigterm sent to process but was converted to a sigkill so assume no errors
-		return 0, nil
+	entries, err := procfile.ParseFile(c.String("procfile"))
+	if err != nil {
+		return nil, err
 	}
 
-	return exit, nil
+	names := make(map[string]bool)
+	for _, e := range entries {
+		names[e.Name] = true
+	}
+	for _, name := range c.StringSlice("procfile-optional") {
+		if !names[name] {
+			return nil, fmt.Errorf("optional process %s not found in procfile", name)
+		}
+	}
+	return entries, nil
+}
+
+func setupRootfs(driver fsdriver.Driver, rootfs string, c *cli.Context) error {
+	if err := driver.SetupRootfs(); err != nil {
+		return err
+	}
+	return writeEtcFiles(rootfs, c)
 }
 
-// call webhook if needed
+// call webhook if needed. Notifications are serialized so that the hook receives them in order
 func statusChanged(c *cli.Context, status notifier.PsStatus) {
-	wh := c.String("web-hook")
-	if wh == "" {
-		return
+	psChanged(c, &notifier.Ps{Status: status})
+}
+
+// report a new status along with its details
+func psChanged(c *cli.Context, ps *notifier.Ps) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	lastStatus = ps.Status
+
+	if controlServer != nil {
+		controlServer.Publish(string(ps.Status))
 	}
-	notifier.WebHook = wh
+	notifyHook(ps)
+}
 
-	if err := notifier.NotifyHook(status); err != nil {
-		log.Error("failed to notify web-hook %s: %v", wh, err)
+// send a status message of the process (see -notify) along with the current status
+func statusMessage(c *cli.Context, message string) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	notifyHook(&notifier.Ps{Status: lastStatus, Message: message})
+}
+
+// queue the hook (see -web-hook), must be called with statusMutex held so that hooks are sent in order
+func notifyHook(ps *notifier.Ps) {
+	if hooks != nil {
+		hooks.Push(ps)
 	}
 }
+
+// last reported status
+func currentStatus() notifier.PsStatus {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	return lastStatus
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/opencontainers/runc/libcontainer/utils"
+
+	"github.com/applidget/psdock/system"
+)
+
+const (
+	// names are reserved by locking a file in this directory, names can't start with a dot so it is not a valid id
+	locksDir = ".locks"
+
+	maxNameLength = 255 // names are used as file names
+
+	// state directories of exited containers are removed after this delay, random names are never reused
+	exitRetention = 24 * time.Hour
+)
+
+// libcontainer id rules, except that names must not start with a dot
+var nameRegexp = regexp.MustCompile(`^[\w][\w.-]*$`)
+
+// id of the container to start: its name (-name) or a random one
+func newContainerID(c *cli.Context) (string, error) {
+	name := c.String("name")
+	if name == "" {
+		return utils.GenerateRandomName("psdock_", 7)
+	}
+	if len(name) > maxNameLength || !nameRegexp.MatchString(name) {
+		return "", fmt.Errorf("invalid container name %q, only [a-zA-Z0-9_.-] are allowed (not starting with a dot)", name)
+	}
+	return name, nil
+}
+
+// reserveID makes sure no other psdock uses the id until the lock is released (or psdock exits).
+// The state directory left by a previous psdock (its exit status and log, or everything if it didn't exit properly)
+// is removed
+func reserveID(id string) (*system.Lock, error) {
+	locks := filepath.Join(containersRoot, locksDir)
+	if err := os.MkdirAll(locks, 0700); err != nil {
+		return nil, err
+	}
+
+	lock, err := system.TryLock(filepath.Join(locks, id))
+	if err == system.ErrLocked {
+		return nil, fmt.Errorf("container name %s is already in use", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(containersRoot, id)
+	if exitedContainer(id) {
+		if err := os.RemoveAll(dir); err != nil {
+			lock.Release()
+			return nil, err
+		}
+	} else if _, err := os.Stat(dir); err == nil {
+		log.Warnf("removing the state of container %s left by a previous psdock", id)
+		if err := removeStaleContainer(id); err != nil {
+			lock.Release()
+			return nil, err
+		}
+	}
+	pruneExited()
+	return lock, nil
+}
+
+// pruneExited removes the state directories of containers which exited more than exitRetention ago
+func pruneExited() {
+	dirs, err := ioutil.ReadDir(containersRoot)
+	if err != nil {
+		log.Warnf("failed to prune exited containers: %v", err)
+		return
+	}
+	for _, dir := range dirs {
+		id := dir.Name()
+		if strings.HasPrefix(id, ".") || time.Since(dir.ModTime()) < exitRetention || !exitedContainer(id) {
+			continue
+		}
+
+		// the name may be reused by a psdock starting right now
+		lock, err := system.TryLock(filepath.Join(containersRoot, locksDir, id))
+		if err != nil {
+			continue
+		}
+		if exitedContainer(id) {
+			if err := os.RemoveAll(filepath.Join(containersRoot, id)); err != nil {
+				log.Warnf("failed to prune exited container %s: %v", id, err)
+			}
+		}
+		lock.Release()
+	}
+}
+
+// exitedContainer tells whether the state directory only holds what is kept once the container exited (exit
+// status, log of a detached launcher), the pid file is removed last when psdock exits properly
+func exitedContainer(id string) bool {
+	dir := filepath.Join(containersRoot, id)
+	if _, err := os.Stat(dir); err != nil {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(dir, pidFile))
+	return os.IsNotExist(err)
+}
+
+func removeStaleContainer(id string) error {
+	dir := filepath.Join(containersRoot, id)
+	unmountSecrets(filepath.Join(dir, secretsDir)) // may not be mounted
+
+	// destroy kills remaining processes and removes cgroups
+	if container, err := loadContainer(id); err == nil {
+		container.Destroy()
+	}
+	return os.RemoveAll(dir)
+}
+
+// resolveID returns the id of the running container designated on the command line by its name (the id)
+// or a unique prefix of it
+func resolveID(name string) (string, error) {
+	if !nameRegexp.MatchString(name) {
+		return "", fmt.Errorf("invalid container name %q", name)
+	}
+	if _, err := os.Stat(filepath.Join(containersRoot, name, pidFile)); err == nil {
+		return name, nil
+	}
+
+	var matches []string
+	for _, id := range runningContainers() {
+		if strings.HasPrefix(id, name) {
+			matches = append(matches, id)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no running container %s", name)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%s is ambiguous, it matches %s", name, strings.Join(matches, ", "))
+	}
+}
+
+// resolve every id given on the command line
+func resolveIDs(names []string) ([]string, error) {
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		id, err := resolveID(name)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
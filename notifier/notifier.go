@@ -7,28 +7,40 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+
+	"github.com/applidget/psdock/exitreason"
 )
 
 type PsStatus string
 
 const (
-	StatusStarting PsStatus = "starting"
-	StatusRunning  PsStatus = "running"
-	StatusCrashed  PsStatus = "crashed"
+	StatusStarting      PsStatus = "starting"
+	StatusRunning       PsStatus = "running"
+	StatusCrashed       PsStatus = "crashed"
+	StatusExited        PsStatus = "exited"
+	StatusPaused        PsStatus = "paused"
+	StatusStopping      PsStatus = "stopping"
+	StatusFailedToStart PsStatus = "failed_to_start"
+	StatusTimedOut      PsStatus = "timed_out"
+
+	StatusHealthy   PsStatus = "healthy"
+	StatusUnhealthy PsStatus = "unhealthy"
 )
 
 var WebHook string
 
 type Ps struct {
-	Status PsStatus `json:"status"`
+	Status  PsStatus         `json:"status"`
+	Message string           `json:"message,omitempty"`
+	Exit    *exitreason.Exit `json:"exit,omitempty"` // sent with the exited and crashed statuses
 }
 
 type HookPayload struct {
 	Ps *Ps `json:"ps"`
 }
 
-func NotifyHook(status PsStatus) error {
-	payload := &HookPayload{&Ps{Status: status}}
+func NotifyHook(ps *Ps) error {
+	payload := &HookPayload{ps}
 
 	body, err := json.Marshal(payload)
 	if err != nil {
@@ -61,7 +73,7 @@ func NotifyHook(status PsStatus) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return fmt.Errorf("bad status code expected 200 .. 299 got %d", resp.Status)
+		return fmt.Errorf("bad status code expected 200 .. 299 got %s", resp.Status)
 	}
 	return nil
 }
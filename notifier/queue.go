@@ -0,0 +1,63 @@
+package notifier
+
+import "sync"
+
+// Queue sends hooks one at a time, in the order they were pushed, without blocking the callers
+type Queue struct {
+	send func(ps *Ps)
+
+	mutex   sync.Mutex
+	pending []*Ps
+	closed  bool
+	wake    chan struct{} // a hook was pushed, closed with the queue
+	done    chan struct{} // closed once every hook was sent after Close
+}
+
+func NewQueue(send func(ps *Ps)) *Queue {
+	q := &Queue{send: send, wake: make(chan struct{}, 1), done: make(chan struct{})}
+	go q.run()
+	return q
+}
+
+// Push queues ps, hooks pushed after Close are dropped
+func (q *Queue) Push(ps *Ps) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return
+	}
+	q.pending = append(q.pending, ps)
+	select {
+	case q.wake <- struct{}{}:
+	default: // already woken up, ps will be sent with the other pending hooks
+	}
+}
+
+// Close waits for the queued hooks to be sent
+func (q *Queue) Close() {
+	q.mutex.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.wake)
+	}
+	q.mutex.Unlock()
+	<-q.done
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+	for range q.wake {
+		for {
+			q.mutex.Lock()
+			if len(q.pending) == 0 {
+				q.mutex.Unlock()
+				break
+			}
+			ps := q.pending[0]
+			q.pending = q.pending[1:]
+			q.mutex.Unlock()
+
+			q.send(ps)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package notifier
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func Test_queue(t *testing.T) {
+	fmt.Printf("hooks queue ... ")
+
+	var sent []PsStatus
+	unblock := make(chan struct{})
+	q := NewQueue(func(ps *Ps) {
+		<-unblock
+		sent = append(sent, ps.Status)
+	})
+
+	// pushing doesn't wait for the hooks to be sent
+	statuses := []PsStatus{StatusStarting, StatusRunning, StatusPaused, StatusRunning, StatusExited}
+	pushed := make(chan struct{})
+	go func() {
+		for _, status := range statuses {
+			q.Push(&Ps{Status: status})
+		}
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("push blocked by a pending hook")
+	}
+
+	// close waits for the pending hooks
+	close(unblock)
+	q.Close()
+	if fmt.Sprint(sent) != fmt.Sprint(statuses) {
+		t.Fatalf("expected %v to be sent in order got %v", statuses, sent)
+	}
+
+	q.Push(&Ps{Status: StatusCrashed})
+	q.Close()
+	if len(sent) != len(statuses) {
+		t.Fatalf("hook sent after close: %v", sent)
+	}
+	fmt.Println("done")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/opencontainers/runc/libcontainer"
+
+	"github.com/applidget/psdock/notifier"
+	"github.com/applidget/psdock/sdnotify"
+)
+
+const (
+	notifySocket     = "notify.sock"
+	notifySocketPath = "/run/notify.sock" // inside the container
+)
+
+// notifyServer translates the sd_notify messages of the process (-notify) into status changes
+type notifyServer struct {
+	listener    *sdnotify.Listener
+	ready       chan struct{} // closed on READY=1
+	readyOnce   sync.Once
+	pings       chan struct{} // WATCHDOG=1
+	trigger     chan struct{} // closed on WATCHDOG=trigger
+	triggerOnce sync.Once
+}
+
+// listen for notifications on a socket in the container state directory, it is bind mounted in the container
+func (l *launcher) listenNotify() (*notifyServer, error) {
+	listener, err := sdnotify.Listen(filepath.Join(containersRoot, l.id, notifySocket))
+	if err != nil {
+		return nil, err
+	}
+
+	n := &notifyServer{
+		listener: listener,
+		ready:    make(chan struct{}),
+		pings:    make(chan struct{}, 1),
+		trigger:  make(chan struct{}),
+	}
+	go listener.Serve(func(m sdnotify.Message) { n.handle(l, m) })
+	return n, nil
+}
+
+func (n *notifyServer) handle(l *launcher, m sdnotify.Message) {
+	if m["READY"] == "1" {
+		n.readyOnce.Do(func() { close(n.ready) })
+	}
+	if status, ok := m["STATUS"]; ok {
+		statusMessage(l.c, status)
+	}
+	if m["STOPPING"] == "1" {
+		statusChanged(l.c, notifier.StatusStopping)
+	}
+
+	switch m["WATCHDOG"] {
+	case "1":
+		select {
+		case n.pings <- struct{}{}:
+		default: // a ping is already pending
+		}
+	case "trigger":
+		n.triggerOnce.Do(func() { close(n.trigger) })
+	}
+}
+
+func (n *notifyServer) Close() error {
+	return n.listener.Close()
+}
+
+// expect a WATCHDOG=1 at least every -watchdog period until exited is closed. When the watchdog expires
+// the process is killed and restarted according to the restart policy (-watchdog-action restart)
+// or the container is stopped (-watchdog-action kill)
+func (l *launcher) watchWatchdog(n *notifyServer, process *libcontainer.Process, exited <-chan struct{}) {
+	timeout := l.c.Duration("watchdog")
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-exited:
+			return
+		case <-n.pings:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(timeout)
+			continue
+		case <-n.trigger:
+			log.Error("watchdog triggered by the process")
+		case <-timer.C:
+			log.Errorf("watchdog expired, no WATCHDOG=1 received for %v", timeout)
+		}
+
+		if l.c.String("watchdog-action") == "kill" {
+			l.signalHandler.terminate(syscall.SIGKILL, 0)
+		} else {
+			process.Signal(syscall.SIGKILL)
+		}
+		return
+	}
+}
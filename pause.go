@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/codegangsta/cli"
+	"github.com/opencontainers/runc/libcontainer"
+
+	"github.com/applidget/psdock/control"
+	"github.com/applidget/psdock/notifier"
+)
+
+// pauseState is the container paused through the control API (psdock pause) and the status to report once resumed
+type pauseState struct {
+	mutex     sync.Mutex
+	container libcontainer.Container // nil if not paused, a container of a previous run once restarted
+	status    notifier.PsStatus      // status of the process before being paused
+}
+
+// freeze (pause = true) or thaw every process of a running container using the freezer cgroup. The request goes
+// through the control API so that the launcher reports the status change
+func pauseAction(c *cli.Context, pause bool) error {
+	if len(c.Args()) != 1 {
+		return fmt.Errorf("usage: psdock %s <container-id>", c.Command.Name)
+	}
+
+	id, err := resolveID(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	client := control.NewClient(filepath.Join(containersRoot, id, controlSocket))
+	if pause {
+		return client.Pause()
+	}
+	return client.Resume()
+}
+
+// freeze every process of container and report the paused status
+func (l *launcher) pause(container libcontainer.Container) error {
+	l.paused.mutex.Lock()
+	defer l.paused.mutex.Unlock()
+
+	if err := container.Pause(); err != nil {
+		return err
+	}
+	if l.paused.container != container {
+		l.paused.container, l.paused.status = container, currentStatus()
+		statusChanged(l.c, notifier.StatusPaused)
+	}
+	return nil
+}
+
+// thaw every process of container, the status the process had before being paused is reported again
+func (l *launcher) resume(container libcontainer.Container) error {
+	l.paused.mutex.Lock()
+	defer l.paused.mutex.Unlock()
+
+	if err := container.Resume(); err != nil {
+		return err
+	}
+	if l.paused.container == container {
+		l.paused.container = nil
+		statusChanged(l.c, l.paused.status)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/applidget/psdock/system"
+	"github.com/codegangsta/cli"
+	"github.com/docker/docker/pkg/term"
+	"github.com/opencontainers/runc/libcontainer/utils"
+)
+
+const (
+	// the psdock binary is bind mounted in the container to be run as its init process
+	initPath = "/dev/init"
+
+	// with -init, psdock init writes the wait status of the command in this file of the container state directory
+	// (bind mounted in the container) so that a command killed by a signal is told apart from one exiting with
+	// 128 + signal number
+	initStatusFile = "init-status"
+	initStatusPath = "/dev/init-status" // inside the container
+)
+
+// pid1Action is run as PID 1 of containers whose processes are started with exec (procfile).
+// It keeps the container alive, reaps orphaned processes and forwards signals to every process
+// of the container. On SIGINT or SIGTERM, it exits once all other processes exited.
+// If a command is given (-init), see runInit
+func pid1Action(c *cli.Context) {
+	sigc := make(chan os.Signal, signalBufferSize)
+	signal.Notify(sigc)
+
+	args := []string(c.Args())
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		os.Exit(runInit(args, sigc))
+	}
+
+	stopping := false
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case sig := <-sigc:
+			switch {
+			case sig == syscall.SIGCHLD:
+				reap()
+			case !system.Forwarded(sig):
+				// not meant for the processes
+			case sig == syscall.SIGTERM, sig == syscall.SIGINT:
+				stopping = true
+				fallthrough
+			default:
+				// -1 targets every process we can signal except ourself, that is the whole pid namespace
+				syscall.Kill(-1, sig.(syscall.Signal))
+			}
+		case <-ticker.C:
+			reap()
+			if stopping && alone() {
+				os.Exit(0)
+			}
+		}
+	}
+}
+
+// runInit spawns the command in its own process group, forwards every signal to this group and reaps
+// orphaned processes until the command exits. It returns the command exit status
+func runInit(args []string, sigc <-chan os.Signal) int {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if term.IsTerminal(os.Stdin.Fd()) {
+		// the process group must be the foreground one to read from the terminal
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = 0
+	}
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "psdock init: %v\n", err)
+		if err, ok := err.(*exec.Error); ok && err.Err == exec.ErrNotFound {
+			return 127
+		}
+		return 126
+	}
+	child := cmd.Process.Pid
+
+	for sig := range sigc {
+		if sig != syscall.SIGCHLD {
+			if system.Forwarded(sig) {
+				syscall.Kill(-child, sig.(syscall.Signal))
+			}
+			continue
+		}
+		if status, exited := reap()[child]; exited {
+			writeInitStatus(status)
+			return utils.ExitStatus(status)
+		}
+	}
+	return 1
+}
+
+// report the wait status of the command to psdock, see initStatusFile
+func writeInitStatus(status syscall.WaitStatus) {
+	f, err := os.OpenFile(initStatusPath, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "psdock init: failed to report the command status: %v\n", err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "%d", uint32(status))
+}
+
+// reap all exited children without blocking, returns their wait status
+func reap() map[int]syscall.WaitStatus {
+	reaped := make(map[int]syscall.WaitStatus)
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if pid <= 0 || err != nil {
+			return reaped
+		}
+		reaped[pid] = status
+	}
+}
+
+// tells whether PID 1 is the only process left in the pid namespace
+func alone() bool {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if pid, err := strconv.Atoi(e.Name()); err == nil && pid != 1 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/utils"
+
+	"github.com/applidget/psdock/environ"
+	"github.com/applidget/psdock/exitreason"
+	"github.com/applidget/psdock/notifier"
+	"github.com/applidget/psdock/procfile"
+	"github.com/applidget/psdock/restart"
+	"github.com/applidget/psdock/shutdown"
+	"github.com/applidget/psdock/stream"
+)
+
+// colors used to prefix the output of procfile processes
+var procfileColors = []stream.Color{stream.Green, stream.Blue, stream.Magenta, stream.Yellow, stream.Cyan, stream.Red}
+
+// procfileStatus computes the combined status of procfile processes: running when all of them are up
+type procfileStatus struct {
+	mutex  sync.Mutex
+	notify func(notifier.PsStatus)
+	up     map[string]bool
+	status notifier.PsStatus
+}
+
+func (s *procfileStatus) set(name string, up bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.up[name] = up
+	s.update()
+}
+
+// remove a process that won't be restarted from the combined status
+func (s *procfileStatus) remove(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.up, name)
+	s.update()
+}
+
+func (s *procfileStatus) update() {
+	status := notifier.StatusRunning
+	for _, up := range s.up {
+		if !up {
+			status = notifier.StatusStarting
+		}
+	}
+	if status != s.status {
+		s.status = status
+		s.notify(status)
+	}
+}
+
+// runProcfile runs every process of the procfile in the same container. The container init is psdock pid1,
+// processes are exec'd in the container and restarted independently according to the restart policy.
+// When a required process won't be restarted, the whole container is stopped and its exit status returned
+func (l *launcher) runProcfile(entries []procfile.Entry, policy *restart.Policy) (int, error) {
+	c := l.c
+
+	optional := make(map[string]bool)
+	for _, name := range c.StringSlice("procfile-optional") {
+		optional[name] = true
+	}
+
+	container, err := l.factory.Create(containerDir, l.config)
+	if err != nil {
+		return 1, err
+	}
+	defer container.Destroy()
+
+	env, err := loadEnv(l.id, c)
+	if err != nil {
+		return 1, err
+	}
+
+	initProcess := &libcontainer.Process{
+		Args:   []string{initPath, "pid1"},
+		Env:    env,
+		Stdout: l.stream,
+		Stderr: l.stream,
+	}
+
+	l.signalHandler.setProcess(container, initProcess, nil)
+	defer l.signalHandler.setProcess(nil, nil, nil)
+
+	statusChanged(c, notifier.StatusStarting)
+	var result *exitreason.Exit // nil if the container couldn't be run
+	defer func() { l.reportExit(result) }()
+
+	hookEnv := &hookEnv{id: l.id, rootfs: l.rootfs, exitCode: -1}
+	if err := runHooks(c, preStart, hookEnv); err != nil {
+		return 1, err
+	}
+	if l.signalHandler.stopRequested() {
+		// stopped while the pre-start hooks ran, the stop signal reached no process: don't start it
+		log.Info("stopped before the container started, not starting it")
+		result = l.classifyExit(exitreason.Facts{})
+		return result.Code, nil
+	}
+
+	if err := container.Start(initProcess); err != nil {
+		return 1, err
+	}
+	defer func() { runPostStop(c, hookEnv, result) }()
+	oom := watchOOM(container)
+
+	hookEnv.pid, _ = initProcess.Pid()
+	if err := runHooks(c, postStart, hookEnv); err != nil {
+		log.Errorf("%v, stopping the container", err)
+		l.signalHandler.terminate(nil, -1)
+	}
+
+	exited := make(chan struct{})
+	defer close(exited)
+
+	status := &procfileStatus{
+		notify: func(s notifier.PsStatus) { statusChanged(c, s) },
+		up:     make(map[string]bool),
+		status: notifier.StatusStarting,
+	}
+	for _, e := range entries {
+		status.up[e.Name] = false
+	}
+
+	var (
+		wg     sync.WaitGroup
+		failed = make(chan syscall.WaitStatus, len(entries)) // wait status of required processes that won't be restarted
+	)
+	for i, e := range entries {
+		prefix := fmt.Sprintf("%s | ", e.Name)
+		s := l.stream.WithPrefix(prefix, procfileColors[i%len(procfileColors)])
+
+		wg.Add(1)
+		go func(e procfile.Entry, s *stream.Stream) {
+			defer wg.Done()
+			exit := l.supervise(container, e, env, s, policy, status)
+			if l.signalHandler.stopRequested() {
+				return
+			}
+			if optional[e.Name] {
+				log.Infof("optional process %s exited with status %d", e.Name, utils.ExitStatus(exit))
+				status.remove(e.Name)
+				return
+			}
+			failed <- exit
+		}(e, s)
+	}
+
+	initExited := make(chan syscall.WaitStatus, 1)
+	go func() {
+		status, err := waitStatus(initProcess)
+		l.signalHandler.processExited()
+		if err != nil {
+			log.Error(err)
+			status = exitedWith(1)
+		}
+		initExited <- status
+	}()
+
+	var (
+		exit    syscall.WaitStatus
+		outcome shutdown.Outcome
+	)
+	select {
+	case exit = <-failed:
+		log.Errorf("required process exited with status %d, stopping the container", utils.ExitStatus(exit))
+		l.signalHandler.terminate(nil, -1)
+		<-initExited
+	case exit = <-initExited:
+		outcome = l.signalHandler.processExited()
+	}
+	wg.Wait()
+
+	facts := exitreason.Facts{Status: utils.ExitStatus(exit), Forced: outcome.Forced, Requested: outcome.Requested}
+	if exit.Signaled() {
+		facts.Signal = exit.Signal()
+	}
+	facts.OOM = oom.oomKilled(facts.Status != 0)
+	result = l.classifyExit(facts)
+
+	return result.Code, nil
+}
+
+// supervise runs a procfile process until it won't be restarted anymore, returns its last wait status
+func (l *launcher) supervise(container libcontainer.Container, e procfile.Entry, env []string, s *stream.Stream, policy *restart.Policy, status *procfileStatus) syscall.WaitStatus {
+	backoff := 0
+	for restarts := 0; ; restarts++ {
+		process := &libcontainer.Process{
+			Args:   []string{"/bin/sh", "-c", e.Command},
+			Env:    environ.Merge(env, []string{"PSDOCK_PROCESS=" + e.Name}),
+			User:   l.c.String("user"),
+			Cwd:    l.c.String("cwd"),
+			Stdout: s,
+			Stderr: s,
+		}
+
+		startedAt := time.Now()
+		if err := container.Start(process); err != nil {
+			log.Errorf("failed to start process %s: %v", e.Name, err)
+			return exitedWith(1)
+		}
+		status.set(e.Name, true)
+
+		waited, err := waitStatus(process)
+		if err != nil {
+			log.Errorf("failed to wait for process %s: %v", e.Name, err)
+			waited = exitedWith(1)
+		}
+		exit := utils.ExitStatus(waited)
+		if l.signalHandler.stopRequested() || !policy.ShouldRestart(exit, restarts) {
+			return waited
+		}
+		status.set(e.Name, false)
+
+		if time.Since(startedAt) > policy.MaxDelay {
+			backoff = 0
+		}
+		delay := policy.Backoff(backoff)
+		backoff++
+		log.Infof("process %s exited with status %d, restarting in %v", e.Name, exit, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-l.signalHandler.stopCh:
+			return waited
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package procfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var nameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Entry is a process type of a Procfile
+type Entry struct {
+	Name    string
+	Command string
+}
+
+func ParseFile(name string) ([]Entry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return entries, nil
+}
+
+// Parse reads a Procfile: one "name: command" per line, blank lines and lines starting with # are ignored
+func Parse(r io.Reader) ([]Entry, error) {
+	var (
+		entries []Entry
+		names   = make(map[string]bool)
+	)
+
+	s := bufio.NewScanner(r)
+	for lineNo := 1; s.Scan(); lineNo++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected name: command, got %q", lineNo, line)
+		}
+		name, cmd := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if !nameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("line %d: invalid process name %q", lineNo, name)
+		}
+		if cmd == "" {
+			return nil, fmt.Errorf("line %d: no command for process %s", lineNo, name)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("line %d: process %s defined multiple times", lineNo, name)
+		}
+		names[name] = true
+		entries = append(entries, Entry{Name: name, Command: cmd})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no process defined")
+	}
+	return entries, nil
+}
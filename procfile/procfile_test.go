@@ -0,0 +1,47 @@
+package procfile
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_parse(t *testing.T) {
+	fmt.Printf("parse procfile ... ")
+
+	content := `
+# processes of the app
+web: bundle exec puma -p $PORT
+worker:   bundle exec sidekiq -c 5
+clock: ruby clock.rb --at 12:00
+`
+	entries, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Entry{
+		{Name: "web", Command: "bundle exec puma -p $PORT"},
+		{Name: "worker", Command: "bundle exec sidekiq -c 5"},
+		{Name: "clock", Command: "ruby clock.rb --at 12:00"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("expected %v got %v", expected, entries)
+	}
+
+	invalids := []string{
+		"",
+		"# only comments",
+		"web bundle exec puma",
+		"web:",
+		"we b: ls",
+		"web: ls\nweb: ps",
+	}
+	for _, invalid := range invalids {
+		if _, err := Parse(strings.NewReader(invalid)); err == nil {
+			t.Fatalf("%q should be rejected", invalid)
+		}
+	}
+	fmt.Println("done")
+}
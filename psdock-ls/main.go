@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/opencontainers/runc/libcontainer"
@@ -13,18 +14,23 @@ import (
 
 const (
 	containersRoot = "/run/psdock"
+	containerDir   = "container" // libcontainer container in the state directory, only while the process runs
 	stateFile      = "state.json"
+	pidFile        = "pid"
 )
 
 type containerState struct {
 	libcontainer.State
+	id                 string
 	launcherProcessPid string
+	status             string
 }
 
 var states []*containerState
 
 func main() {
 	listStates()
+	states = filterStates(states, os.Args[1:])
 
 	if len(states) == 0 {
 		fmt.Println("No psdock container running")
@@ -33,54 +39,113 @@ func main() {
 
 	tw := tabwriter.NewWriter(os.Stdout, 0, 10, 3, '\t', 0)
 
-	fmt.Fprintln(tw, "#\tCONTAINER_ID\tPID\tINIT_PID\tROOTFS\tCOMMAND")
+	fmt.Fprintln(tw, "#\tCONTAINER_ID\tSTATUS\tPID\tINIT_PID\tROOTFS\tCOMMAND")
 	for i, state := range states {
 		runningCmd, err := cmdForPid(state.InitProcessPid)
 		if err != nil {
 			runningCmd = "unknown"
 		}
-		line := fmt.Sprintf("%d\t%s\t%s\t%d\t%s\t%s", i, state.ID, state.launcherProcessPid, state.InitProcessPid, state.Config.Rootfs, runningCmd)
+		line := fmt.Sprintf("%d\t%s\t%s\t%s\t%d\t%s\t%s", i, state.id, state.status, state.launcherProcessPid, state.InitProcessPid, state.Config.Rootfs, runningCmd)
 		fmt.Fprintln(tw, line)
 		tw.Flush()
 	}
 }
 
-func visit(path string, fi os.FileInfo, err error) error {
-	if path == containersRoot {
-		return nil
+// visit the state directory of a container, it is kept while its psdock runs
+func visit(dir string) error {
+	b, err := ioutil.ReadFile(filepath.Join(dir, pidFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // exited, only its exit status is left
+		}
+		return err
 	}
+	cs := &containerState{id: filepath.Base(dir), launcherProcessPid: strings.TrimSpace(string(b)), status: "restarting"}
 
-	if filepath.Base(path) != stateFile {
+	f, err := os.Open(filepath.Join(dir, containerDir, stateFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		if !removed(dir) {
+			// process waiting for a restart
+			states = append(states, cs)
+		}
 		return nil
 	}
+	defer f.Close()
 
-	f, err := os.Open(path)
-	if err != nil {
+	if err := json.NewDecoder(f).Decode(&cs.State); err != nil {
 		return err
 	}
-	defer f.Close()
+	if removed(dir) {
+		return nil // exited while listing
+	}
+	cs.status = containerStatus(dir)
+	states = append(states, cs)
+	return nil
+}
 
-	var state libcontainer.State
-	if err := json.NewDecoder(f).Decode(&state); err != nil {
-		return err
+// tells whether the state directory was removed, libcontainer would create it again
+func removed(dir string) bool {
+	_, err := os.Stat(dir)
+	return os.IsNotExist(err)
+}
+
+// running or paused
+func containerStatus(dir string) string {
+	if _, err := os.Stat(filepath.Join(dir, containerDir)); err != nil {
+		return "unknown"
+	}
+	factory, err := libcontainer.New(dir, libcontainer.Cgroupfs)
+	if err != nil {
+		return "unknown"
+	}
+	container, err := factory.Load(containerDir)
+	if err != nil {
+		return "unknown"
+	}
+	status, err := container.Status()
+	if err != nil {
+		return "unknown"
 	}
+	return status.String()
+}
 
-	pidFile := filepath.Join(filepath.Dir(path), "pid")
-	launcherPid := "-1"
-	b, err := ioutil.ReadFile(pidFile)
-	if err == nil {
-		launcherPid = string(b)
+// keep containers whose name (id) starts with one of the given names, every container if none is given
+func filterStates(all []*containerState, names []string) []*containerState {
+	if len(names) == 0 {
+		return all
 	}
 
-	states = append(states, &containerState{state, launcherPid})
-	return nil
+	var filtered []*containerState
+	for _, state := range all {
+		for _, name := range names {
+			if strings.HasPrefix(state.id, name) {
+				filtered = append(filtered, state)
+				break
+			}
+		}
+	}
+	return filtered
 }
 
 func listStates() {
-	err := filepath.Walk(containersRoot, visit)
-	if err != nil {
+	dirs, err := ioutil.ReadDir(containersRoot)
+	if err != nil && !os.IsNotExist(err) {
 		panic(err)
 	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || strings.HasPrefix(dir.Name(), ".") {
+			continue // names reservations
+		}
+		if err := visit(filepath.Join(containersRoot, dir.Name())); err != nil {
+			if os.IsNotExist(err) {
+				continue // exited while listing
+			}
+			fmt.Fprintf(os.Stderr, "%s: %v\n", dir.Name(), err)
+		}
+	}
 }
 
 func cmdForPid(pid int) (string, error) {
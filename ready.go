@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/opencontainers/runc/libcontainer"
+
+	"github.com/applidget/psdock/notifier"
+	"github.com/applidget/psdock/ready"
+	"github.com/applidget/psdock/system"
+)
+
+// wait for the readiness conditions (-bind-port, -ready-log, -ready-file, -notify) to report the running status.
+// reported channels are closed once the process reported it is ready (output matching -ready-log, READY=1).
+// If the process is not ready within -startup-timeout, the failed_to_start status is reported and
+// -startup-timeout-action applies, failed is closed if the container is stopped
+func (l *launcher) waitReady(container libcontainer.Container, process *libcontainer.Process, reported []<-chan struct{}, failed chan<- struct{}, exited <-chan struct{}) {
+	c := l.c
+
+	var conditions []ready.Condition
+	if port := c.String("bind-port"); port != "" {
+		conditions = append(conditions, portBound(container, port))
+	}
+	for _, ch := range reported {
+		conditions = append(conditions, ready.Channel(ch))
+	}
+	if path := c.String("ready-file"); path != "" {
+		pid, err := process.Pid()
+		if err != nil {
+			log.Errorf("failed to get the process pid: %v", err)
+			return
+		}
+		// looked up in the process mount namespace, the file may be on a tmpfs (ex: /run with -read-only)
+		conditions = append(conditions, ready.File(filepath.Join("/proc", strconv.Itoa(pid), "root"), path))
+	}
+
+	mode, _ := ready.ParseMode(c.String("ready-require")) // validated on start
+	timeout, action := c.Duration("startup-timeout"), c.String("startup-timeout-action")
+
+	err := ready.Wait(conditions, mode, timeout, exited)
+	if err == ready.ErrTimeout {
+		statusChanged(c, notifier.StatusFailedToStart)
+
+		switch action {
+		case "restart":
+			log.Errorf("process not ready after %v, killing it", timeout)
+			process.Signal(syscall.SIGKILL)
+			return
+		case "kill":
+			log.Errorf("process not ready after %v, stopping the container", timeout)
+			close(failed)
+			l.signalHandler.terminate(syscall.SIGKILL, 0)
+			return
+		}
+
+		// reported only, the process may still become ready
+		log.Errorf("process not ready after %v", timeout)
+		err = ready.Wait(conditions, mode, 0, exited)
+	}
+
+	switch err {
+	case nil:
+		statusChanged(c, notifier.StatusRunning)
+	case ready.ErrStopped:
+	default:
+		// if this arise, we just do not change process status
+		log.Errorf("failed to check if the process is ready: %v", err)
+	}
+}
+
+// met once the port is bound by one of the container processes
+func portBound(container libcontainer.Container, port string) ready.Condition {
+	return ready.Poll(func() (bool, error) {
+		pids, err := container.Processes()
+		if err != nil {
+			return false, fmt.Errorf("failed to get back container processes: %v", err)
+		}
+
+		bound, err := system.IsPortBound(port, pids)
+		if err != nil {
+			//will retry
+			log.Errorf("failed to check if port %s is bound: %v", port, err)
+			return false, nil
+		}
+		return bound, nil
+	})
+}
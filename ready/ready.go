@@ -0,0 +1,178 @@
+package ready
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTimeout = errors.New("not ready before timeout")
+	ErrStopped = errors.New("stopped before being ready")
+
+	// PollInterval is the delay between two checks of polled conditions
+	PollInterval = 200 * time.Millisecond
+)
+
+const maxSymlinks = 255 // same limit as the kernel
+
+// Condition blocks until the process is ready and returns nil. It must return ErrStopped as soon as stop is closed
+type Condition func(stop <-chan struct{}) error
+
+// Mode tells how conditions are combined
+type Mode int
+
+const (
+	All Mode = iota // every condition must be met
+	Any             // the first condition met is enough
+)
+
+// ParseMode parses all or any
+func ParseMode(raw string) (Mode, error) {
+	switch raw {
+	case "all":
+		return All, nil
+	case "any":
+		return Any, nil
+	default:
+		return All, fmt.Errorf("invalid mode %s, expected all or any", raw)
+	}
+}
+
+// Wait blocks until the conditions are met according to mode. It returns ErrTimeout if they are not met
+// within timeout (if positive), ErrStopped if stop is closed first, or the error of a condition that can't be met
+// (in Any mode, only once every condition failed)
+func Wait(conditions []Condition, mode Mode, timeout time.Duration, stop <-chan struct{}) error {
+	done := make(chan struct{}) // stops the conditions still running
+	defer close(done)
+
+	results := make(chan error, len(conditions))
+	for _, c := range conditions {
+		go func(c Condition) {
+			results <- c(done)
+		}(c)
+	}
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	var (
+		met, failed int
+		lastErr     error
+	)
+	for met+failed < len(conditions) {
+		select {
+		case err := <-results:
+			if err != nil {
+				if mode == All {
+					return err
+				}
+				failed++
+				lastErr = err
+				continue
+			}
+			met++
+			if mode == Any || met == len(conditions) {
+				return nil
+			}
+		case <-timeoutCh:
+			return ErrTimeout
+		case <-stop:
+			return ErrStopped
+		}
+	}
+	return lastErr
+}
+
+// Channel is met once ch is closed
+func Channel(ch <-chan struct{}) Condition {
+	return func(stop <-chan struct{}) error {
+		select {
+		case <-ch:
+			return nil
+		case <-stop:
+			return ErrStopped
+		}
+	}
+}
+
+// File is met once path exists in the filesystem rooted at root. Symlinks in the directories of path are followed
+// as if root was the root directory, path itself is not followed
+func File(root, path string) Condition {
+	return Poll(func() (bool, error) {
+		resolved, err := resolve(root, path)
+		if err != nil {
+			return false, err
+		}
+		if _, err := os.Lstat(resolved); err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	})
+}
+
+// resolve returns the path of the file designated by path in the filesystem rooted at root. Symlinks in the
+// directories of path are resolved inside root: absolute targets start from root and .. can't go above it
+func resolve(root, path string) (string, error) {
+	current := "/" // resolved part of path, relative to root
+	rest := strings.Split(filepath.Clean("/"+path), "/")[1:]
+	links := 0
+	for len(rest) > 1 {
+		name := rest[0]
+		rest = rest[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+			continue
+		}
+
+		next := filepath.Join(current, name)
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			// not a symlink, or not created yet
+			current = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", fmt.Errorf("too many levels of symbolic links in %s", path)
+		}
+		if filepath.IsAbs(target) {
+			current = "/"
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+	// joined to current first, a trailing .. can't go above root
+	return filepath.Join(root, filepath.Join(current, rest[0])), nil
+}
+
+// Poll is met once check returns true, it is called every PollInterval. The condition fails if check returns an error
+func Poll(check func() (bool, error)) Condition {
+	return func(stop <-chan struct{}) error {
+		for {
+			ok, err := check()
+			if err != nil {
+				return err
+			}
+			if ok {
+				return nil
+			}
+			select {
+			case <-time.After(PollInterval):
+			case <-stop:
+				return ErrStopped
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package ready
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func init() {
+	PollInterval = 10 * time.Millisecond
+}
+
+func Test_parseMode(t *testing.T) {
+	fmt.Printf("parse ready mode ... ")
+
+	if m, err := ParseMode("all"); err != nil || m != All {
+		t.Fatalf("expected all got %v %v", m, err)
+	}
+	if m, err := ParseMode("any"); err != nil || m != Any {
+		t.Fatalf("expected any got %v %v", m, err)
+	}
+	if _, err := ParseMode("some"); err == nil {
+		t.Fatal("invalid mode must be rejected")
+	}
+	fmt.Println("done")
+}
+
+func Test_waitAll(t *testing.T) {
+	fmt.Printf("wait all conditions ... ")
+
+	a, b := make(chan struct{}), make(chan struct{})
+	result := make(chan error)
+	go func() {
+		result <- Wait([]Condition{Channel(a), Channel(b)}, All, 0, nil)
+	}()
+
+	close(a)
+	select {
+	case err := <-result:
+		t.Fatalf("must wait for every condition, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(b)
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Wait(nil, All, 0, nil); err != nil {
+		t.Fatalf("no condition means ready, got %v", err)
+	}
+	fmt.Println("done")
+}
+
+func Test_waitAny(t *testing.T) {
+	fmt.Printf("wait any condition ... ")
+
+	failing := Condition(func(stop <-chan struct{}) error { return errors.New("failed") })
+
+	a := make(chan struct{})
+	close(a)
+	if err := Wait([]Condition{failing, Channel(make(chan struct{})), Channel(a)}, Any, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Wait([]Condition{failing, failing}, Any, 0, nil); err == nil {
+		t.Fatal("expected an error when every condition failed")
+	}
+	if err := Wait([]Condition{failing, Channel(a)}, All, 0, nil); err == nil {
+		t.Fatal("expected an error when a condition failed")
+	}
+	fmt.Println("done")
+}
+
+func Test_timeoutAndStop(t *testing.T) {
+	fmt.Printf("wait timeout and stop ... ")
+
+	never := Channel(make(chan struct{}))
+	if err := Wait([]Condition{never}, All, 20*time.Millisecond, nil); err != ErrTimeout {
+		t.Fatalf("expected ErrTimeout got %v", err)
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	if err := Wait([]Condition{never}, All, 0, stop); err != ErrStopped {
+		t.Fatalf("expected ErrStopped got %v", err)
+	}
+	fmt.Println("done")
+}
+
+func Test_file(t *testing.T) {
+	fmt.Printf("ready file ... ")
+
+	dir, err := ioutil.TempDir("", "psdock-ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "ready")
+	time.AfterFunc(30*time.Millisecond, func() {
+		ioutil.WriteFile(path, nil, 0600)
+	})
+
+	if err := Wait([]Condition{File(dir, "/ready")}, All, time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("done")
+}
+
+func Test_resolve(t *testing.T) {
+	fmt.Printf("resolve paths in root ... ")
+
+	root, err := ioutil.TempDir("", "psdock-ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := os.MkdirAll(filepath.Join(root, "var/run"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"run":     "/var/run",
+		"rel":     "var/../var/run",
+		"escape":  "../../..",
+		"loop":    "/loop",
+		"var/lnk": "/run",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for path, expected := range map[string]string{
+		"/app.ready":         "/app.ready",
+		"/run/app.ready":     "/var/run/app.ready",
+		"run/app.ready":      "/var/run/app.ready",
+		"/rel/app.ready":     "/var/run/app.ready",
+		"/var/lnk/app.ready": "/var/run/app.ready",
+		"/escape/etc/passwd": "/etc/passwd",
+		"/../../etc/passwd":  "/etc/passwd",
+		"/escape/..":         "/",
+		"/missing/app.ready": "/missing/app.ready",
+		"/run":               "/run", // not followed
+	} {
+		resolved, err := resolve(root, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolved != filepath.Join(root, expected) {
+			t.Fatalf("%s: expected %s got %s", path, filepath.Join(root, expected), resolved)
+		}
+	}
+
+	if _, err := resolve(root, "/loop/app.ready"); err == nil {
+		t.Fatal("expected an error on symlinks loop")
+	}
+	fmt.Println("done")
+}
@@ -0,0 +1,85 @@
+package restart
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Mode string
+
+const (
+	No        Mode = "no"
+	OnFailure Mode = "on-failure"
+	Always    Mode = "always"
+)
+
+var (
+	defaultDelay    = 1 * time.Second
+	defaultMaxDelay = 1 * time.Minute
+)
+
+// Policy tells whether a process should be restarted once it exited and how long to wait before doing so.
+// The delay doubles on each restart, starting at Delay and bounded by MaxDelay
+type Policy struct {
+	Mode       Mode
+	MaxRetries int // only for on-failure, 0 means no limit
+	Delay      time.Duration
+	MaxDelay   time.Duration
+}
+
+// ParsePolicy parses policies with the following format: no|on-failure[:max-retries]|always
+func ParsePolicy(raw string) (*Policy, error) {
+	p := &Policy{Mode: No, Delay: defaultDelay, MaxDelay: defaultMaxDelay}
+
+	parts := strings.SplitN(raw, ":", 2)
+	switch Mode(parts[0]) {
+	case "", No:
+		if len(parts) == 2 {
+			return nil, fmt.Errorf("invalid restart policy %s, max retries is only supported by on-failure", raw)
+		}
+	case Always:
+		if len(parts) == 2 {
+			return nil, fmt.Errorf("invalid restart policy %s, max retries is only supported by on-failure", raw)
+		}
+		p.Mode = Always
+	case OnFailure:
+		p.Mode = OnFailure
+		if len(parts) == 2 {
+			max, err := strconv.Atoi(parts[1])
+			if err != nil || max < 0 {
+				return nil, fmt.Errorf("invalid restart policy max retries %s", parts[1])
+			}
+			p.MaxRetries = max
+		}
+	default:
+		return nil, fmt.Errorf("invalid restart policy %s", raw)
+	}
+	return p, nil
+}
+
+// ShouldRestart tells if a process that exited with the given exit code and already restarted
+// the given number of times, must be restarted
+func (p *Policy) ShouldRestart(exitCode, restarts int) bool {
+	switch p.Mode {
+	case Always:
+		return true
+	case OnFailure:
+		return exitCode != 0 && (p.MaxRetries == 0 || restarts < p.MaxRetries)
+	default:
+		return false
+	}
+}
+
+// Backoff returns the delay to wait before the next restart
+func (p *Policy) Backoff(restarts int) time.Duration {
+	delay := p.Delay
+	for i := 0; i < restarts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
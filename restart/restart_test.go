@@ -0,0 +1,77 @@
+package restart
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func Test_parsePolicy(t *testing.T) {
+	fmt.Printf("parse restart policy ... ")
+
+	valid := map[string]Policy{
+		"":              {Mode: No},
+		"no":            {Mode: No},
+		"always":        {Mode: Always},
+		"on-failure":    {Mode: OnFailure},
+		"on-failure:10": {Mode: OnFailure, MaxRetries: 10},
+	}
+	for raw, expected := range valid {
+		p, err := ParsePolicy(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Mode != expected.Mode || p.MaxRetries != expected.MaxRetries {
+			t.Fatalf("%s: expected %v got %v", raw, expected, *p)
+		}
+	}
+
+	for _, raw := range []string{"sometimes", "always:3", "no:1", "on-failure:-1", "on-failure:foo"} {
+		if _, err := ParsePolicy(raw); err == nil {
+			t.Fatalf("%s should be rejected", raw)
+		}
+	}
+	fmt.Println("done")
+}
+
+func Test_shouldRestart(t *testing.T) {
+	fmt.Printf("should restart ... ")
+
+	no, _ := ParsePolicy("no")
+	always, _ := ParsePolicy("always")
+	onFailure, _ := ParsePolicy("on-failure:2")
+
+	cases := []struct {
+		policy   *Policy
+		exit     int
+		restarts int
+		expected bool
+	}{
+		{no, 1, 0, false},
+		{always, 0, 0, true},
+		{always, 1, 100, true},
+		{onFailure, 0, 0, false},
+		{onFailure, 1, 0, true},
+		{onFailure, 1, 1, true},
+		{onFailure, 1, 2, false},
+	}
+	for _, c := range cases {
+		if r := c.policy.ShouldRestart(c.exit, c.restarts); r != c.expected {
+			t.Fatalf("%v with exit %d after %d restarts: expected %v got %v", *c.policy, c.exit, c.restarts, c.expected, r)
+		}
+	}
+	fmt.Println("done")
+}
+
+func Test_backoff(t *testing.T) {
+	fmt.Printf("restart backoff ... ")
+
+	p := &Policy{Mode: Always, Delay: time.Second, MaxDelay: 10 * time.Second}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for restarts, d := range expected {
+		if b := p.Backoff(restarts); b != d {
+			t.Fatalf("after %d restarts expected %v got %v", restarts, d, b)
+		}
+	}
+	fmt.Println("done")
+}
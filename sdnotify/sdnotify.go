@@ -0,0 +1,63 @@
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// maximum size of a notification datagram
+const maxMessageSize = 4096
+
+// Message is a notification sent by a process (see sd_notify(3)), ex: READY=1, STATUS=..., WATCHDOG=1
+type Message map[string]string
+
+// Parse parses a notification made of newline separated KEY=VALUE assignments, malformed lines are ignored
+func Parse(b []byte) Message {
+	m := make(Message)
+	for _, line := range strings.Split(string(b), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			continue
+		}
+		m[parts[0]] = parts[1]
+	}
+	return m
+}
+
+// Listener receives notifications on a unix datagram socket
+type Listener struct {
+	conn *net.UnixConn
+}
+
+// Listen creates the socket at path, any user may send notifications to it
+func Listen(path string) (*Listener, error) {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	// the process may run as any user inside the container
+	if err := os.Chmod(path, 0666); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Listener{conn: conn}, nil
+}
+
+// Serve calls handler for each notification received until the listener is closed
+func (l *Listener) Serve(handler func(Message)) error {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, _, err := l.conn.ReadFromUnix(buf)
+		if err != nil {
+			return err
+		}
+		if m := Parse(buf[:n]); len(m) > 0 {
+			handler(m)
+		}
+	}
+}
+
+func (l *Listener) Close() error {
+	return l.conn.Close()
+}
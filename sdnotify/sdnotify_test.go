@@ -0,0 +1,78 @@
+package sdnotify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_parse(t *testing.T) {
+	fmt.Printf("parse notification ... ")
+
+	m := Parse([]byte("READY=1\nSTATUS=Processing requests: 2=ok\nmalformed\n=1\n"))
+	if len(m) != 2 {
+		t.Fatalf("expected 2 assignments got %v", m)
+	}
+	if m["READY"] != "1" {
+		t.Fatalf("expected READY=1 got %q", m["READY"])
+	}
+	if m["STATUS"] != "Processing requests: 2=ok" {
+		t.Fatalf("unexpected STATUS %q", m["STATUS"])
+	}
+	fmt.Println("done")
+}
+
+func Test_listener(t *testing.T) {
+	fmt.Printf("notify listener ... ")
+
+	dir, err := ioutil.TempDir("", "psdock-sdnotify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "notify.sock")
+
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := make(chan Message, 2)
+	served := make(chan error)
+	go func() {
+		served <- l.Serve(func(m Message) { messages <- m })
+	}()
+
+	conn, err := net.Dial("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, notification := range []string{"", "WATCHDOG=1", "READY=1\nSTATUS=up"} {
+		if _, err := conn.Write([]byte(notification)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, expected := range []string{"WATCHDOG", "STATUS"} {
+		select {
+		case m := <-messages:
+			if _, ok := m[expected]; !ok {
+				t.Fatalf("expected %s got %v", expected, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("notification not received")
+		}
+	}
+
+	l.Close()
+	if err := <-served; err == nil {
+		t.Fatal("Serve must return once closed")
+	}
+	fmt.Println("done")
+}
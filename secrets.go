@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// secrets are copied to a tmpfs (never written on disk) that is bind mounted read only inside the container
+const (
+	secretsDir       = "secrets"
+	secretsMountPath = "/run/secrets"
+)
+
+// expected format for secrets: name=/path/on/host
+func parseSecrets(rawSecrets []string) (map[string]string, error) {
+	secrets := make(map[string]string)
+	for _, rawSecret := range rawSecrets {
+		parts := strings.SplitN(rawSecret, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid secret %s", rawSecret)
+		}
+		name := parts[0]
+		if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid secret name %q", name)
+		}
+		if _, exists := secrets[name]; exists {
+			return nil, fmt.Errorf("secret %s specified multiple times", name)
+		}
+		secrets[name] = parts[1]
+	}
+	return secrets, nil
+}
+
+// mount a tmpfs in dir and copy secrets in it, readable only by the given uid. The tmpfs is just big enough
+// for the secrets, files take whole pages
+func mountSecrets(dir string, secrets map[string]string, uid, gid int) error {
+	contents := make(map[string][]byte, len(secrets))
+	pageSize := os.Getpagesize()
+	size := pageSize // the directory itself
+	for name, source := range secrets {
+		content, err := ioutil.ReadFile(source)
+		if err != nil {
+			return fmt.Errorf("failed to read secret %s: %v", name, err)
+		}
+		contents[name] = content
+		size += (len(content) + pageSize - 1) / pageSize * pageSize
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := syscall.Mount("tmpfs", dir, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, fmt.Sprintf("mode=0755,size=%d", size)); err != nil {
+		return err
+	}
+
+	for name, content := range contents {
+		dest := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(dest, content, 0400); err != nil {
+			return err
+		}
+		if err := os.Chown(dest, uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmounting the tmpfs wipes the secrets
+func unmountSecrets(dir string) error {
+	if err := syscall.Unmount(dir, syscall.MNT_DETACH); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,181 @@
+package shutdown
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/applidget/psdock/system"
+)
+
+// Step sends Signal then waits Timeout for the process to exit before moving to the next step
+type Step struct {
+	Signal  syscall.Signal
+	Timeout time.Duration // unused for the last step
+}
+
+func (s Step) String() string {
+	name := strings.TrimPrefix(system.SignalName(s.Signal), "SIG")
+	if s.Timeout > 0 {
+		return name + ":" + s.Timeout.String()
+	}
+	return name
+}
+
+// ParseChain parses an escalation chain like TERM:10s,INT:5s,KILL. Every step but the last one needs a timeout,
+// plain numbers are seconds. A single signal (QUIT) is a valid chain
+func ParseChain(raw string) ([]Step, error) {
+	var chain []Step
+	parts := strings.Split(raw, ",")
+	for i, part := range parts {
+		last := i == len(parts)-1
+
+		fields := strings.SplitN(strings.TrimSpace(part), ":", 2)
+		sig, err := system.ParseSignal(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		step := Step{Signal: sig}
+
+		if len(fields) == 2 {
+			if last {
+				return nil, fmt.Errorf("invalid step %s, the last step can't have a timeout", part)
+			}
+			if step.Timeout, err = parseTimeout(fields[1]); err != nil {
+				return nil, fmt.Errorf("invalid step %s: %v", part, err)
+			}
+		} else if !last {
+			return nil, fmt.Errorf("invalid step %s, a timeout is required before the next step", part)
+		}
+
+		if sig == syscall.SIGKILL && !last {
+			return nil, fmt.Errorf("invalid chain %s, KILL must be the last step", raw)
+		}
+		chain = append(chain, step)
+	}
+	return chain, nil
+}
+
+func parseTimeout(raw string) (time.Duration, error) {
+	if n, err := strconv.Atoi(raw); err == nil {
+		raw = strconv.Itoa(n) + "s"
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("timeout must be positive")
+	}
+	return d, nil
+}
+
+// Outcome tells how a process was stopped
+type Outcome struct {
+	Requested bool           // a stop was requested from outside psdock before the process exited
+	Signal    syscall.Signal // last signal delivered by the sequence
+	Forced    bool           // SIGKILL was delivered by the sequence
+}
+
+// Sequence stops a single process by walking an escalation chain. Signals are never delivered once Exited was called
+type Sequence struct {
+	mutex   sync.Mutex
+	deliver func(sig syscall.Signal) bool
+	started bool
+	exited  bool
+	outcome Outcome
+	done    chan struct{} // closed on exit, stops the escalation
+}
+
+// NewSequence returns a sequence delivering signals with deliver, which returns false if the process ignores the
+// signal (the sequence then moves to the next step straight away)
+func NewSequence(deliver func(sig syscall.Signal) bool) *Sequence {
+	return &Sequence{deliver: deliver, done: make(chan struct{})}
+}
+
+// Run starts walking chain. Only the first call escalates, later calls just deliver the first signal of their
+// chain (a second SIGINT, or a SIGKILL while the process is still stopping). requested tells whether the stop
+// was asked from outside psdock (signal, psdock stop ...) rather than decided by psdock because the process failed
+func (s *Sequence) Run(chain []Step, requested bool) {
+	if len(chain) == 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	started := s.started
+	s.started = true
+	if !s.exited && requested {
+		s.outcome.Requested = true
+	}
+	s.mutex.Unlock()
+
+	if started {
+		s.send(chain[0].Signal)
+		return
+	}
+
+	// first step is sent synchronously so the caller knows the process got it
+	delivered, alive := s.send(chain[0].Signal)
+	if !alive || (delivered && len(chain) == 1) {
+		return
+	}
+	go s.escalate(chain, delivered)
+}
+
+func (s *Sequence) escalate(chain []Step, delivered bool) {
+	for i := 0; ; {
+		last := i == len(chain)-1
+		if last {
+			if !delivered && chain[i].Signal != syscall.SIGKILL {
+				// nothing left to try
+				s.send(syscall.SIGKILL)
+			}
+			return
+		}
+
+		if delivered {
+			select {
+			case <-time.After(chain[i].Timeout):
+			case <-s.done:
+				return
+			}
+		}
+
+		i++
+		var alive bool
+		if delivered, alive = s.send(chain[i].Signal); !alive {
+			return
+		}
+	}
+}
+
+// send delivers sig unless the process exited
+func (s *Sequence) send(sig syscall.Signal) (delivered, alive bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.exited {
+		return false, false
+	}
+	if !s.deliver(sig) {
+		return false, true
+	}
+	s.outcome.Signal = sig
+	if sig == syscall.SIGKILL {
+		s.outcome.Forced = true
+	}
+	return true, true
+}
+
+// Exited must be called once the process exited, it stops the escalation and returns how the process was stopped
+func (s *Sequence) Exited() Outcome {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.exited {
+		s.exited = true
+		close(s.done)
+	}
+	return s.outcome
+}
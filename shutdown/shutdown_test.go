@@ -0,0 +1,160 @@
+package shutdown
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_parseChain(t *testing.T) {
+	fmt.Printf("parse escalation chain ... ")
+
+	chain, err := ParseChain("TERM:10s,SIGINT:5,KILL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Step{
+		{Signal: syscall.SIGTERM, Timeout: 10 * time.Second},
+		{Signal: syscall.SIGINT, Timeout: 5 * time.Second},
+		{Signal: syscall.SIGKILL},
+	}
+	if !reflect.DeepEqual(chain, expected) {
+		t.Fatalf("expected %v got %v", expected, chain)
+	}
+
+	chain, err = ParseChain("quit")
+	if err != nil || len(chain) != 1 || chain[0].Signal != syscall.SIGQUIT {
+		t.Fatalf("expected a single QUIT step got %v %v", chain, err)
+	}
+
+	for _, raw := range []string{"", "TERM,KILL", "TERM:10s", "KILL:1s,TERM", "TERM:0s,KILL", "TERM:soon,KILL", "FOO"} {
+		if _, err := ParseChain(raw); err == nil {
+			t.Fatalf("%q must be rejected", raw)
+		}
+	}
+	fmt.Println("done")
+}
+
+// recorder delivers signals to a fake process ignoring some of them
+type recorder struct {
+	mutex   sync.Mutex
+	ignored map[syscall.Signal]bool
+	sent    []syscall.Signal
+}
+
+func (r *recorder) deliver(sig syscall.Signal) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.ignored[sig] {
+		return false
+	}
+	r.sent = append(r.sent, sig)
+	return true
+}
+
+func (r *recorder) signals() []syscall.Signal {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]syscall.Signal{}, r.sent...)
+}
+
+func Test_escalation(t *testing.T) {
+	fmt.Printf("escalate signals ... ")
+
+	r := &recorder{}
+	s := NewSequence(r.deliver)
+	s.Run([]Step{{syscall.SIGTERM, 20 * time.Millisecond}, {syscall.SIGINT, 20 * time.Millisecond}, {syscall.SIGKILL, 0}}, true)
+	time.Sleep(100 * time.Millisecond)
+
+	expected := []syscall.Signal{syscall.SIGTERM, syscall.SIGINT, syscall.SIGKILL}
+	if sent := r.signals(); !reflect.DeepEqual(sent, expected) {
+		t.Fatalf("expected %v got %v", expected, sent)
+	}
+	if o := s.Exited(); !o.Requested || !o.Forced || o.Signal != syscall.SIGKILL {
+		t.Fatalf("unexpected outcome %+v", o)
+	}
+	fmt.Println("done")
+}
+
+func Test_exitStopsEscalation(t *testing.T) {
+	fmt.Printf("no signal after exit ... ")
+
+	r := &recorder{}
+	s := NewSequence(r.deliver)
+	s.Run([]Step{{syscall.SIGTERM, 20 * time.Millisecond}, {syscall.SIGKILL, 0}}, true)
+	o := s.Exited()
+	time.Sleep(50 * time.Millisecond)
+
+	if sent := r.signals(); !reflect.DeepEqual(sent, []syscall.Signal{syscall.SIGTERM}) {
+		t.Fatalf("expected only SIGTERM got %v", sent)
+	}
+	if !o.Requested || o.Forced || o.Signal != syscall.SIGTERM {
+		t.Fatalf("unexpected outcome %+v", o)
+	}
+
+	s.Run([]Step{{syscall.SIGKILL, 0}}, true)
+	if sent := r.signals(); len(sent) != 1 {
+		t.Fatalf("signal sent after exit: %v", sent)
+	}
+
+	// nothing requested
+	if o := NewSequence(r.deliver).Exited(); o.Requested || o.Forced {
+		t.Fatalf("unexpected outcome %+v", o)
+	}
+
+	// stopped by psdock on its own
+	s = NewSequence(r.deliver)
+	s.Run([]Step{{syscall.SIGKILL, 0}}, false)
+	if o := s.Exited(); o.Requested || !o.Forced {
+		t.Fatalf("unexpected outcome %+v", o)
+	}
+	fmt.Println("done")
+}
+
+func Test_ignoredSignals(t *testing.T) {
+	fmt.Printf("skip ignored signals ... ")
+
+	r := &recorder{ignored: map[syscall.Signal]bool{syscall.SIGTERM: true}}
+	s := NewSequence(r.deliver)
+	s.Run([]Step{{syscall.SIGTERM, time.Hour}, {syscall.SIGINT, 0}}, true)
+	time.Sleep(20 * time.Millisecond)
+	if sent := r.signals(); !reflect.DeepEqual(sent, []syscall.Signal{syscall.SIGINT}) {
+		t.Fatalf("expected SIGINT straight away got %v", sent)
+	}
+	s.Exited()
+
+	// ignored last step falls back to SIGKILL
+	r = &recorder{ignored: map[syscall.Signal]bool{syscall.SIGQUIT: true}}
+	s = NewSequence(r.deliver)
+	s.Run([]Step{{syscall.SIGQUIT, 0}}, true)
+	time.Sleep(20 * time.Millisecond)
+	if sent := r.signals(); !reflect.DeepEqual(sent, []syscall.Signal{syscall.SIGKILL}) {
+		t.Fatalf("expected SIGKILL got %v", sent)
+	}
+	if o := s.Exited(); !o.Forced {
+		t.Fatalf("expected a forced kill %+v", o)
+	}
+	fmt.Println("done")
+}
+
+func Test_laterRequests(t *testing.T) {
+	fmt.Printf("later stop requests ... ")
+
+	r := &recorder{}
+	s := NewSequence(r.deliver)
+	s.Run([]Step{{syscall.SIGTERM, time.Hour}, {syscall.SIGKILL, 0}}, true)
+	s.Run([]Step{{syscall.SIGINT, time.Hour}, {syscall.SIGKILL, 0}}, true)
+	s.Run([]Step{{syscall.SIGKILL, 0}}, true)
+
+	expected := []syscall.Signal{syscall.SIGTERM, syscall.SIGINT, syscall.SIGKILL}
+	if sent := r.signals(); !reflect.DeepEqual(sent, expected) {
+		t.Fatalf("expected %v got %v", expected, sent)
+	}
+	if o := s.Exited(); !o.Forced {
+		t.Fatalf("expected a forced kill %+v", o)
+	}
+	fmt.Println("done")
+}
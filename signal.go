@@ -3,21 +3,87 @@ package main
 import (
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/applidget/psdock/shutdown"
 	"github.com/applidget/psdock/system"
 	"github.com/opencontainers/runc/libcontainer"
 )
 
 const signalBufferSize = 2048
 
+// -signal-scope values
+const (
+	scopeInit  = "init"  // the container init process
+	scopeGroup = "group" // the process group of the init
+	scopeAll   = "all"   // every process of the container
+)
+
 type signalHandler struct {
-	process     *libcontainer.Process
+	mutex       sync.Mutex
+	container   libcontainer.Container
+	process     *libcontainer.Process // nil between two runs of the process
 	tty         *tty
-	forceKilled bool
-	killTimeout int // timeout in seconds
+	sequence    *shutdown.Sequence // stops the current process
+	stopChain   []shutdown.Step    // -stop-signal, nil to stop with the received signal
+	killTimeout time.Duration      // -kill-timeout, negative to never kill the process
+	stopCh      chan struct{}      // closed once a SIGINT or SIGTERM is received
+	stopOnce    sync.Once
+	forwardsAll bool                              // the container init is psdock (-init, -procfile), it catches and forwards every signal
+	signalMap   map[syscall.Signal]syscall.Signal // -signal-map, applied to forwarded signals
+	scope       string                            // -signal-scope
+}
+
+func newSignalHandler(stopChain []shutdown.Step, killTimeout time.Duration) *signalHandler {
+	return &signalHandler{stopChain: stopChain, killTimeout: killTimeout, stopCh: make(chan struct{})}
+}
+
+func (h *signalHandler) setProcess(container libcontainer.Container, process *libcontainer.Process, tty *tty) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.container, h.process, h.tty, h.sequence = container, process, tty, nil
+	if process != nil {
+		h.sequence = shutdown.NewSequence(func(sig syscall.Signal) bool {
+			return h.deliver(container, process, sig)
+		})
+	}
+}
+
+// processExited must be called once the current process exited, no stop signal is sent afterwards
+func (h *signalHandler) processExited() shutdown.Outcome {
+	h.mutex.Lock()
+	sequence := h.sequence
+	h.mutex.Unlock()
+	if sequence == nil {
+		return shutdown.Outcome{}
+	}
+	return sequence.Exited()
+}
+
+// container running the current process, nil between two runs of the process
+func (h *signalHandler) currentContainer() libcontainer.Container {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.container
+}
+
+func (h *signalHandler) current() (*libcontainer.Process, *tty) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.process, h.tty
+}
+
+// tells whether the process has been asked to stop, in this case it must not be restarted
+func (h *signalHandler) stopRequested() bool {
+	select {
+	case <-h.stopCh:
+		return true
+	default:
+		return false
+	}
 }
 
 func (h *signalHandler) startCatching() {
@@ -40,30 +106,83 @@ func (h *signalHandler) startCatching() {
 
 // terminal resize signal
 func (h *signalHandler) handleSigwinch() {
-	if h.tty != nil {
-		h.tty.resize()
+	if _, tty := h.current(); tty != nil {
+		tty.resize()
 	}
 }
 
 // handle sigterm and sigint
 func (h *signalHandler) handleInterupt(sig os.Signal) error {
-	// init process will have PID 1 in the namespace and by default PID 1 ignore all signals (https://github.com/docker/docker/issues/7846)
-	// expect sigkill of course. Solution: inspect signal status (/proc/PID/signal), if it doesn't handle any signals, kill it otherwise
-	// just forward the signal
+	return h.stop(sig, -1)
+}
 
-	// if sigint or sigterm, check if the signal can caught them, if yes, send it otherwise kill the process (SIGSTOP and SIGKILL can't be caught)
-	pid, err := h.process.Pid()
-	if err != nil {
-		//couldn't get pid, fallback (probably the process died, already, anyway falling back to default)
-		return h.handleDefault(sig)
+// gracefully stop the process on request (received signal, psdock stop, control API) by walking the -stop-signal
+// chain, sig (nil for the chain one) replaces the first signal of the chain unless it is a SIGINT or SIGTERM and
+// -stop-signal is set. The process is killed after timeout (--kill-timeout is used if timeout is negative)
+func (h *signalHandler) stop(sig os.Signal, timeout time.Duration) error {
+	return h.shutdown(sig, timeout, true)
+}
+
+// stop the process like stop, on psdock own decision (the process failed, -timeout elapsed ...). Its exit is not
+// reported as requested
+func (h *signalHandler) terminate(sig os.Signal, timeout time.Duration) error {
+	return h.shutdown(sig, timeout, false)
+}
+
+func (h *signalHandler) shutdown(sig os.Signal, timeout time.Duration, requested bool) error {
+	h.stopOnce.Do(func() { close(h.stopCh) })
+
+	h.mutex.Lock()
+	sequence := h.sequence
+	h.mutex.Unlock()
+	if sequence == nil {
+		// process not running (waiting for a restart), nothing to stop
+		return nil
 	}
 
-	if h.killTimeout >= 0 {
-		go func() {
-			<-time.After(time.Duration(h.killTimeout) * time.Second)
-			h.forceKilled = true
-			h.process.Signal(syscall.SIGKILL)
-		}()
+	sequence.Run(h.chain(sig, timeout), requested)
+	return nil
+}
+
+// chain returns the escalation chain to stop the process
+func (h *signalHandler) chain(sig os.Signal, timeout time.Duration) []shutdown.Step {
+	if sig == syscall.SIGKILL {
+		return []shutdown.Step{{Signal: syscall.SIGKILL}}
+	}
+
+	chain := h.stopChain
+	if chain == nil {
+		chain = []shutdown.Step{{Signal: syscall.SIGTERM}}
+	}
+	if sig != nil && (h.stopChain == nil || sig != syscall.SIGTERM && sig != syscall.SIGINT) {
+		// the received signal replaces the first step, explicit signals always do
+		chain = append([]shutdown.Step{{Signal: sig.(syscall.Signal), Timeout: chain[0].Timeout}}, chain[1:]...)
+	}
+
+	if timeout >= 0 {
+		return []shutdown.Step{{Signal: chain[0].Signal, Timeout: timeout}, {Signal: syscall.SIGKILL}}
+	}
+	if last := chain[len(chain)-1]; h.killTimeout >= 0 && last.Signal != syscall.SIGKILL {
+		last.Timeout = h.killTimeout
+		chain = append(append([]shutdown.Step{}, chain[:len(chain)-1]...), last, shutdown.Step{Signal: syscall.SIGKILL})
+	}
+	return chain
+}
+
+// deliver sends a stop signal, it returns false if the process would ignore it
+func (h *signalHandler) deliver(container libcontainer.Container, process *libcontainer.Process, sig syscall.Signal) bool {
+	if sig == syscall.SIGKILL || h.forwardsAll {
+		// psdock init forwards every signal, no need for the SIGKILL fallback
+		return h.signal(container, process, sig)
+	}
+
+	// init process will have PID 1 in the namespace and by default PID 1 ignore all signals (https://github.com/docker/docker/issues/7846)
+	// expect sigkill of course. Solution: inspect signal status (/proc/PID/signal), if it doesn't handle the signal,
+	// the next step of the chain is used (SIGKILL ultimately) otherwise just forward the signal
+	pid, err := process.Pid()
+	if err != nil {
+		//couldn't get pid, fallback (probably the process died, already, anyway falling back to default)
+		return h.signal(container, process, sig)
 	}
 
 	ps, err := system.NewProcStatus(pid)
@@ -72,17 +191,71 @@ func (h *signalHandler) handleInterupt(sig os.Signal) error {
 			//real error here, logging out
 			log.Error(err)
 		}
-		return h.handleDefault(sig)
+		return h.signal(container, process, sig)
 	}
 
-	if ps.SignalCaught(sig.(syscall.Signal)) {
-		return h.handleDefault(sig)
+	if !ps.SignalCaught(sig) {
+		return false
 	}
+	return h.signal(container, process, sig)
+}
 
-	h.forceKilled = true
-	return h.process.Signal(syscall.SIGKILL)
+// signal sends a stop signal, errors (the process probably exited already) don't need to escalate
+func (h *signalHandler) signal(container libcontainer.Container, process *libcontainer.Process, sig syscall.Signal) bool {
+	if err := h.send(container, process, sig); err != nil {
+		log.Debugf("failed to send %s: %v", system.SignalName(sig), err)
+	}
+	return true
 }
 
+// forward a received signal to the process, according to -signal-map
 func (h *signalHandler) handleDefault(sig os.Signal) error {
-	return h.process.Signal(sig)
+	if !system.Forwarded(sig) {
+		return nil
+	}
+
+	h.mutex.Lock()
+	container, process := h.container, h.process
+	h.mutex.Unlock()
+	if process == nil {
+		return nil
+	}
+
+	s := sig.(syscall.Signal)
+	if mapped, ok := h.signalMap[s]; ok {
+		s = mapped
+	}
+	return h.send(container, process, s)
+}
+
+// send delivers sig to the processes of the container selected by -signal-scope
+func (h *signalHandler) send(container libcontainer.Container, process *libcontainer.Process, sig syscall.Signal) error {
+	switch h.scope {
+	case scopeGroup:
+		pid, err := process.Pid()
+		if err != nil {
+			return err
+		}
+		pgid, err := syscall.Getpgid(pid)
+		if err != nil {
+			return err
+		}
+		// the init shares the process group of psdock unless it created its own, only the init is signaled then
+		if pgid != syscall.Getpgrp() {
+			return syscall.Kill(-pgid, sig)
+		}
+	case scopeAll:
+		pids, err := container.Processes()
+		if err != nil {
+			return err
+		}
+		for _, pid := range pids {
+			// processes may exit in the meantime
+			if err := syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+				return err
+			}
+		}
+		return nil
+	}
+	return process.Signal(sig)
 }
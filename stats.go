@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/opencontainers/runc/libcontainer"
+)
+
+// containerStats are resource usage of a container, rates are computed over the last interval
+type containerStats struct {
+	ID                  string  `json:"id"`
+	CPUPercent          float64 `json:"cpu_percent"`
+	CPUThrottledPeriods uint64  `json:"cpu_throttled_periods"`
+	CPUThrottledTime    uint64  `json:"cpu_throttled_time_ns"`
+	MemoryUsage         uint64  `json:"memory_usage"`
+	MemoryLimit         uint64  `json:"memory_limit"`
+	MemoryCache         uint64  `json:"memory_cache"`
+	Pids                int     `json:"pids"`
+	BlockRead           uint64  `json:"block_read"`
+	BlockWrite          uint64  `json:"block_write"`
+	BlockReadRate       float64 `json:"block_read_rate"`
+	BlockWriteRate      float64 `json:"block_write_rate"`
+}
+
+const noMemoryLimit = 1 << 62
+
+type statsSample struct {
+	at    time.Time
+	stats *libcontainer.Stats
+}
+
+// display resource usage of the given containers (or all running containers) every interval
+func statsAction(c *cli.Context) error {
+	format := c.String("format")
+	if format != "table" && format != "json" {
+		return fmt.Errorf("invalid format %s, expected table or json", format)
+	}
+	interval := c.Duration("interval")
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+
+	requested, err := resolveIDs(c.Args())
+	if err != nil {
+		return err
+	}
+
+	previous := make(map[string]statsSample)
+	for {
+		ids := requested
+		if len(ids) == 0 {
+			ids = runningContainers()
+		}
+
+		var all []*containerStats
+		for _, id := range ids {
+			container, err := loadContainer(id)
+			if err != nil {
+				if len(c.Args()) > 0 {
+					return err
+				}
+				continue // container exited or waiting for a restart in the meantime
+			}
+
+			stats, err := container.Stats()
+			if err != nil {
+				if c.Bool("no-stream") {
+					return fmt.Errorf("failed to get stats of container %s: %v", id, err)
+				}
+				continue
+			}
+			cur := statsSample{at: time.Now(), stats: stats}
+
+			if prev, ok := previous[id]; ok {
+				pids, _ := container.Processes()
+				all = append(all, computeStats(id, prev, cur, len(pids)))
+			}
+			previous[id] = cur
+		}
+
+		if len(all) > 0 || len(ids) == 0 {
+			if err := printStats(all, format); err != nil {
+				return err
+			}
+			if c.Bool("no-stream") {
+				return nil
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+func computeStats(id string, prev, cur statsSample, pids int) *containerStats {
+	var (
+		elapsed = cur.at.Sub(prev.at).Seconds()
+		p       = prev.stats.CgroupStats
+		s       = cur.stats.CgroupStats
+	)
+
+	cs := &containerStats{
+		ID:                  id,
+		CPUThrottledPeriods: s.CpuStats.ThrottlingData.ThrottledPeriods,
+		CPUThrottledTime:    s.CpuStats.ThrottlingData.ThrottledTime,
+		MemoryUsage:         s.MemoryStats.Usage.Usage,
+		MemoryCache:         s.MemoryStats.Cache,
+		Pids:                pids,
+	}
+	// limit enforced by the cgroup, the kernel reports a huge value (max int64 rounded to pages) without limit
+	if limit := s.MemoryStats.Usage.Limit; limit < noMemoryLimit {
+		cs.MemoryLimit = limit
+	}
+
+	if elapsed > 0 {
+		cpuDelta := float64(delta(s.CpuStats.CpuUsage.TotalUsage, p.CpuStats.CpuUsage.TotalUsage)) // nanoseconds
+		cs.CPUPercent = cpuDelta / (elapsed * float64(time.Second)) * 100
+	}
+
+	prevRead, prevWrite := blockIO(prev.stats)
+	cs.BlockRead, cs.BlockWrite = blockIO(cur.stats)
+	if elapsed > 0 {
+		cs.BlockReadRate = float64(delta(cs.BlockRead, prevRead)) / elapsed
+		cs.BlockWriteRate = float64(delta(cs.BlockWrite, prevWrite)) / elapsed
+	}
+	return cs
+}
+
+// counters are reset when the container is restarted
+func delta(cur, prev uint64) uint64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+// total bytes read and written on block devices
+func blockIO(stats *libcontainer.Stats) (read, write uint64) {
+	for _, entry := range stats.CgroupStats.BlkioStats.IoServiceBytesRecursive {
+		switch entry.Op {
+		case "Read":
+			read += entry.Value
+		case "Write":
+			write += entry.Value
+		}
+	}
+	return read, write
+}
+
+func printStats(all []*containerStats, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		for _, cs := range all {
+			if err := enc.Encode(cs); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	fmt.Print("\033[2J\033[H") // clear the terminal to refresh the table
+	tw := tabwriter.NewWriter(os.Stdout, 0, 10, 3, ' ', 0)
+	fmt.Fprintln(tw, "CONTAINER_ID\tCPU %\tTHROTTLED\tMEM USAGE / LIMIT\tMEM CACHE\tPIDS\tBLOCK I/O\tBLOCK I/O RATE")
+	for _, cs := range all {
+		limit := "unlimited"
+		if cs.MemoryLimit > 0 {
+			limit = humanSize(float64(cs.MemoryLimit))
+		}
+		fmt.Fprintf(tw, "%s\t%.2f\t%d (%v)\t%s / %s\t%s\t%d\t%s / %s\t%s/s / %s/s\n",
+			cs.ID, cs.CPUPercent, cs.CPUThrottledPeriods, time.Duration(cs.CPUThrottledTime),
+			humanSize(float64(cs.MemoryUsage)), limit, humanSize(float64(cs.MemoryCache)), cs.Pids,
+			humanSize(float64(cs.BlockRead)), humanSize(float64(cs.BlockWrite)),
+			humanSize(cs.BlockReadRate), humanSize(cs.BlockWriteRate))
+	}
+	return tw.Flush()
+}
+
+func humanSize(size float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", size, units[i])
+}
+
+// ids of the containers whose psdock is running, their process may be waiting for a restart
+func runningContainers() []string {
+	var ids []string
+	dirs, _ := ioutil.ReadDir(containersRoot)
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(containersRoot, dir.Name(), pidFile)); err == nil {
+			ids = append(ids, dir.Name())
+		}
+	}
+	return ids
+}
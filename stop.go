@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+
+	"github.com/applidget/psdock/control"
+	"github.com/applidget/psdock/labels"
+	"github.com/applidget/psdock/system"
+)
+
+const labelsFile = "labels.json"
+
+// gracefully stop containers and wait for them to exit
+func stopAction(c *cli.Context) error {
+	ids, err := selectContainers(c)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Duration(-1) // container -kill-timeout
+	if c.Int("timeout") >= 0 {
+		timeout = time.Duration(c.Int("timeout")) * time.Second
+	}
+
+	return stopContainers(ids, func(client *control.Client) error {
+		return client.Stop(0, timeout)
+	})
+}
+
+// send a signal to the process of containers. A SIGKILL stops the container (it won't be restarted)
+// and the command waits for it to exit, other signals are just delivered
+func killAction(c *cli.Context) error {
+	ids, err := selectContainers(c)
+	if err != nil {
+		return err
+	}
+
+	sig, err := system.ParseSignal(c.String("signal"))
+	if err != nil {
+		return err
+	}
+
+	if sig != syscall.SIGKILL {
+		failed := 0
+		for _, id := range ids {
+			if err := control.NewClient(filepath.Join(containersRoot, id, controlSocket)).Signal(sig); err != nil {
+				log.Errorf("%s: %v", id, err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to signal %d container(s)", failed)
+		}
+		return nil
+	}
+
+	return stopContainers(ids, func(client *control.Client) error {
+		return client.Stop(syscall.SIGKILL, 0)
+	})
+}
+
+// stop containers using their control API and wait for their launcher to exit. Stopped containers ids are printed
+func stopContainers(ids []string, stop func(*control.Client) error) error {
+	failed := 0
+	launchers := make(map[string]*system.Watcher)
+	for _, id := range ids {
+		// the launcher holds the lock of the container name until it exits, unlike its pid it can't be reused
+		w, err := system.WatchLock(filepath.Join(containersRoot, locksDir, id))
+		if err == nil {
+			err = stop(control.NewClient(filepath.Join(containersRoot, id, controlSocket)))
+			if err != nil {
+				w.Close()
+			}
+		} else if os.IsNotExist(err) {
+			err = fmt.Errorf("no running container %s", id)
+		}
+		if err != nil {
+			log.Errorf("%s: %v", id, err)
+			failed++
+			continue
+		}
+		launchers[id] = w
+	}
+
+	for _, id := range ids {
+		w, ok := launchers[id]
+		if !ok {
+			continue
+		}
+		if err := w.Wait(); err != nil {
+			log.Errorf("%s: %v", id, err)
+			failed++
+			continue
+		}
+		fmt.Println(id)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to stop %d container(s)", failed)
+	}
+	return nil
+}
+
+// containers addressed by the command: the ids given as arguments or, with -all or -label, the running containers
+// matching the label filters
+func selectContainers(c *cli.Context) ([]string, error) {
+	filters := c.StringSlice("label")
+	if len(c.Args()) > 0 {
+		if c.Bool("all") || len(filters) > 0 {
+			return nil, fmt.Errorf("container ids can't be used with -all or -label")
+		}
+		return resolveIDs(c.Args())
+	}
+	if !c.Bool("all") && len(filters) == 0 {
+		return nil, fmt.Errorf("usage: psdock %s [OPTIONS] <container-id...>|-all|-label key=value", c.Command.Name)
+	}
+
+	var ids []string
+	for _, id := range runningContainers() {
+		l, err := readLabels(id)
+		if err != nil {
+			log.Errorf("%s: %v", id, err)
+			continue
+		}
+		if labels.Match(l, filters) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// labels of a container are stored in its state directory
+func writeLabels(id string, l map[string]string) error {
+	if len(l) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(containersRoot, id, labelsFile), b, 0600)
+}
+
+func readLabels(id string) (map[string]string, error) {
+	l := make(map[string]string)
+	b, err := ioutil.ReadFile(filepath.Join(containersRoot, id, labelsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return l, nil // no labels
+		}
+		return nil, err
+	}
+	return l, json.Unmarshal(b, &l)
+}
@@ -1,12 +1,15 @@
 package stream
 
 import (
+	"bytes"
 	"crypto/tls"
 	"io"
 	"net"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/pkg/term"
@@ -14,6 +17,9 @@ import (
 
 const (
 	DIAL_TIMEOUT = 5 * time.Second
+
+	// longer lines are truncated before being matched by watchers
+	maxWatchedLineSize = 64 * 1024
 )
 
 type Color uint8
@@ -35,6 +41,16 @@ type Stream struct {
 	Input   io.Reader
 	Output  io.Writer
 	CloseCh chan bool
+
+	watchMutex sync.Mutex
+	watchers   map[*lineWatcher]bool
+}
+
+// lineWatcher matches lines written to a stream
+type lineWatcher struct {
+	re      *regexp.Regexp
+	line    []byte // current line, until a \n is written
+	matched chan struct{}
 }
 
 func NewStream(uri string, pref string, prefColor Color) (*Stream, error) {
@@ -83,19 +99,29 @@ func NewStream(uri string, pref string, prefColor Color) (*Stream, error) {
 		s.Output = conn
 	}
 
-	if pref != "" {
-		if prefColor == NoColor {
-			s.prefix = []byte(pref)
-		} else {
-			s.prefix = []byte(escapeCode(prefColor) + pref + resetEscapeCode())
-		}
-	}
-
+	s.setPrefix(pref, prefColor)
 	s.CloseCh = make(chan bool, 10)
 
 	return s, nil
 }
 
+// WithPrefix returns a stream writing to the same output with a different prefix
+func (s *Stream) WithPrefix(pref string, prefColor Color) *Stream {
+	ps := &Stream{URL: s.URL, Input: s.Input, Output: s.Output, CloseCh: s.CloseCh}
+	ps.setPrefix(pref, prefColor)
+	return ps
+}
+
+func (s *Stream) setPrefix(pref string, prefColor Color) {
+	if pref == "" {
+		s.prefix = nil
+	} else if prefColor == NoColor {
+		s.prefix = []byte(pref)
+	} else {
+		s.prefix = []byte(escapeCode(prefColor) + pref + resetEscapeCode())
+	}
+}
+
 //tell whether or not the stream is interactive
 func (s *Stream) Interactive() bool {
 	_, isConnIn := s.Input.(net.Conn)
@@ -113,7 +139,66 @@ func (s *Stream) Terminal() bool {
 	return isTerminalIn && isTerminalOut
 }
 
+// Watch returns a channel closed once a line matching re is written to the stream (lines are matched
+// without the stream prefix). cancel stops watching
+func (s *Stream) Watch(re *regexp.Regexp) (matched <-chan struct{}, cancel func()) {
+	s.watchMutex.Lock()
+	defer s.watchMutex.Unlock()
+
+	w := &lineWatcher{re: re, matched: make(chan struct{})}
+	if s.watchers == nil {
+		s.watchers = make(map[*lineWatcher]bool)
+	}
+	s.watchers[w] = true
+
+	return w.matched, func() {
+		s.watchMutex.Lock()
+		defer s.watchMutex.Unlock()
+		delete(s.watchers, w)
+	}
+}
+
+func (s *Stream) feedWatchers(p []byte) {
+	s.watchMutex.Lock()
+	defer s.watchMutex.Unlock()
+
+	for w := range s.watchers {
+		if w.feed(p) {
+			close(w.matched)
+			delete(s.watchers, w)
+		}
+	}
+}
+
+// feed returns true once a line matches
+func (w *lineWatcher) feed(p []byte) bool {
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.append(p)
+			return false
+		}
+		w.append(p[:i])
+		line := bytes.TrimRight(w.line, "\r")
+		w.line = w.line[:0]
+		if w.re.Match(line) {
+			return true
+		}
+		p = p[i+1:]
+	}
+	return false
+}
+
+func (w *lineWatcher) append(p []byte) {
+	if room := maxWatchedLineSize - len(w.line); len(p) > room {
+		p = p[:room]
+	}
+	w.line = append(w.line, p...)
+}
+
 func (s *Stream) Write(p []byte) (int, error) {
+	s.feedWatchers(p)
+
 	if len(s.prefix) == 0 {
 		return s.Output.Write(p)
 	}
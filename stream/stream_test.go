@@ -6,8 +6,10 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"regexp"
 	"sync"
 	"testing"
+	"time"
 )
 
 func Test_remoteStream(t *testing.T) {
@@ -93,3 +95,69 @@ func Test_fileStream(t *testing.T) {
 
 	fmt.Println("done")
 }
+
+func Test_withPrefix(t *testing.T) {
+	fmt.Printf("Stream with different prefixes ... ")
+	s, err := NewStream("file:///tmp/psdock_test_prefix.log", "", NoColor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := s.WithPrefix("web | ", NoColor)
+	worker := s.WithPrefix("worker | ", NoColor)
+	web.Write([]byte("foo\n"))
+	worker.Write([]byte("bar\n"))
+	s.Write([]byte("baz\n"))
+	s.Close()
+
+	content, err := ioutil.ReadFile("/tmp/psdock_test_prefix.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove("/tmp/psdock_test_prefix.log")
+	expected := "web | foo\nworker | bar\nbaz\n"
+	if string(content) != expected {
+		t.Fatalf("expecting %q got %q", expected, string(content))
+	}
+
+	fmt.Println("done")
+}
+
+func Test_watch(t *testing.T) {
+	fmt.Printf("Watch stream lines ... ")
+	s, err := NewStream("file:///tmp/psdock_test_watch.log", "prefix ", NoColor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove("/tmp/psdock_test_watch.log")
+	defer s.Close()
+
+	matched, _ := s.Watch(regexp.MustCompile(`^listening on port \d+$`))
+	other, cancel := s.Watch(regexp.MustCompile(`never`))
+	cancel()
+
+	// the matching line is split across writes and follows a non matching one
+	for _, p := range []string{"starting\r\nlistening on ", "port 80", "80\r\n"} {
+		select {
+		case <-matched:
+			t.Fatalf("matched before %q was written", p)
+		default:
+		}
+		if _, err := s.Write([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-matched:
+	case <-time.After(time.Second):
+		t.Fatal("expected the line to be matched")
+	}
+
+	s.Write([]byte("never\n"))
+	select {
+	case <-other:
+		t.Fatal("a cancelled watch must not be matched")
+	default:
+	}
+	fmt.Println("done")
+}
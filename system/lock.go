@@ -0,0 +1,85 @@
+package system
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// ErrLocked is returned by TryLock when another process holds the lock
+var ErrLocked = errors.New("locked by another process")
+
+// Lock is an exclusive lock on a file. It is released when the process exits, even if it crashes
+type Lock struct {
+	f    *os.File
+	path string
+}
+
+// TryLock takes an exclusive lock on the file at path, creating it if needed. It doesn't block
+func TryLock(path string) (*Lock, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			f.Close()
+			if err == syscall.EWOULDBLOCK {
+				return nil, ErrLocked
+			}
+			return nil, err
+		}
+
+		// the previous owner may have removed the file between the open and the flock,
+		// in this case the lock is on an unlinked file and must be taken again
+		var locked, current syscall.Stat_t
+		if err := syscall.Fstat(int(f.Fd()), &locked); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := syscall.Stat(path, &current); err != nil && err != syscall.ENOENT {
+			f.Close()
+			return nil, err
+		} else if err == nil && locked.Dev == current.Dev && locked.Ino == current.Ino {
+			return &Lock{f: f, path: path}, nil
+		}
+		f.Close()
+	}
+}
+
+// Release removes the lock file and releases the lock
+func (l *Lock) Release() error {
+	os.Remove(l.path)
+	return l.f.Close()
+}
+
+// Watcher waits for the release of a lock held by another process
+type Watcher struct {
+	f *os.File
+}
+
+// WatchLock opens the lock file at path to wait for its release. The file must be opened while the lock is held: if
+// it is removed and locked again afterwards, the new lock is not waited for
+func WatchLock(path string) (*Watcher, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{f: f}, nil
+}
+
+// Wait blocks until the lock is released, the watcher is closed afterwards
+func (w *Watcher) Wait() error {
+	defer w.Close()
+	for {
+		err := syscall.Flock(int(w.f.Fd()), syscall.LOCK_SH)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// Close stops watching the lock
+func (w *Watcher) Close() error {
+	return w.f.Close()
+}
@@ -0,0 +1,95 @@
+package system
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_tryLock(t *testing.T) {
+	fmt.Printf("try lock ... ")
+
+	dir, err := ioutil.TempDir("", "psdock-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "name")
+
+	l, err := TryLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flock locks are bound to open files, a second open in the same process conflicts
+	if _, err := TryLock(path); err != ErrLocked {
+		t.Fatalf("expected ErrLocked got %v", err)
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("lock file must be removed once released")
+	}
+
+	l, err = TryLock(path)
+	if err != nil {
+		t.Fatalf("expected the lock to be available once released got %v", err)
+	}
+	l.Release()
+	fmt.Println("done")
+}
+
+func Test_watchLock(t *testing.T) {
+	fmt.Printf("watch lock ... ")
+
+	dir, err := ioutil.TempDir("", "psdock-lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "name")
+
+	if _, err := WatchLock(path); !os.IsNotExist(err) {
+		t.Fatalf("expected a not exist error got %v", err)
+	}
+
+	l, err := TryLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := WatchLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	released := make(chan error)
+	go func() { released <- w.Wait() }()
+	select {
+	case <-released:
+		t.Fatal("the lock is still held")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the name is locked again right away, only the watched lock matters
+	l.Release()
+	l, err = TryLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Release()
+
+	select {
+	case err := <-released:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the release was not noticed")
+	}
+	fmt.Println("done")
+}
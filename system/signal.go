@@ -0,0 +1,109 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var signals = map[string]syscall.Signal{
+	"ABRT":   syscall.SIGABRT,
+	"ALRM":   syscall.SIGALRM,
+	"BUS":    syscall.SIGBUS,
+	"CHLD":   syscall.SIGCHLD,
+	"CONT":   syscall.SIGCONT,
+	"FPE":    syscall.SIGFPE,
+	"HUP":    syscall.SIGHUP,
+	"ILL":    syscall.SIGILL,
+	"INT":    syscall.SIGINT,
+	"IO":     syscall.SIGIO,
+	"KILL":   syscall.SIGKILL,
+	"PIPE":   syscall.SIGPIPE,
+	"PROF":   syscall.SIGPROF,
+	"PWR":    syscall.SIGPWR,
+	"QUIT":   syscall.SIGQUIT,
+	"SEGV":   syscall.SIGSEGV,
+	"STKFLT": syscall.SIGSTKFLT,
+	"STOP":   syscall.SIGSTOP,
+	"SYS":    syscall.SIGSYS,
+	"TERM":   syscall.SIGTERM,
+	"TRAP":   syscall.SIGTRAP,
+	"TSTP":   syscall.SIGTSTP,
+	"TTIN":   syscall.SIGTTIN,
+	"TTOU":   syscall.SIGTTOU,
+	"URG":    syscall.SIGURG,
+	"USR1":   syscall.SIGUSR1,
+	"USR2":   syscall.SIGUSR2,
+	"VTALRM": syscall.SIGVTALRM,
+	"WINCH":  syscall.SIGWINCH,
+	"XCPU":   syscall.SIGXCPU,
+	"XFSZ":   syscall.SIGXFSZ,
+}
+
+// ParseSignal parses a signal name (TERM, SIGTERM, term) or number (15)
+func ParseSignal(name string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(name); err == nil {
+		if n <= 0 || n > 64 {
+			return 0, fmt.Errorf("invalid signal number %d", n)
+		}
+		return syscall.Signal(n), nil
+	}
+
+	sig, ok := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("unknown signal %s", name)
+	}
+	return sig, nil
+}
+
+// SignalName returns the name of a signal (ex: SIGTERM), or its number if unknown
+func SignalName(sig syscall.Signal) string {
+	for name, s := range signals {
+		if s == sig {
+			return "SIG" + name
+		}
+	}
+	return strconv.Itoa(int(sig))
+}
+
+// ParseSignalMap parses signal remappings like HUP=USR2 (the received signal is delivered as the second one).
+// Signals stopping the process, resizing its terminal or that can't be caught can't be remapped
+func ParseSignalMap(raw []string) (map[syscall.Signal]syscall.Signal, error) {
+	m := map[syscall.Signal]syscall.Signal{}
+	for _, r := range raw {
+		parts := strings.SplitN(r, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid signal mapping %s, expected FROM=TO", r)
+		}
+		from, err := ParseSignal(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		switch from {
+		case syscall.SIGINT, syscall.SIGTERM, syscall.SIGWINCH, syscall.SIGKILL, syscall.SIGSTOP:
+			return nil, fmt.Errorf("%s can't be remapped, use -stop-signal to change how the process is stopped", SignalName(from))
+		}
+		to, err := ParseSignal(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := m[from]; ok {
+			return nil, fmt.Errorf("%s is mapped twice", SignalName(from))
+		}
+		m[from] = to
+	}
+	return m, nil
+}
+
+// Forwarded tells whether a signal received by psdock is forwarded to the processes. Like tini, signals which are not
+// meant for them are not: SIGURG is used by the Go runtime to preempt goroutines, SIGPIPE is raised by writes of
+// psdock itself and SIGCHLD reports the exit of its own children
+func Forwarded(sig os.Signal) bool {
+	switch sig {
+	case syscall.SIGCHLD, syscall.SIGURG, syscall.SIGPIPE:
+		return false
+	}
+	return true
+}
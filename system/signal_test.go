@@ -0,0 +1,83 @@
+package system
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func Test_parseSignal(t *testing.T) {
+	fmt.Printf("parse signal ... ")
+
+	valid := map[string]syscall.Signal{
+		"TERM":    syscall.SIGTERM,
+		"SIGTERM": syscall.SIGTERM,
+		"sigquit": syscall.SIGQUIT,
+		"usr2":    syscall.SIGUSR2,
+		"9":       syscall.SIGKILL,
+	}
+	for name, expected := range valid {
+		sig, err := ParseSignal(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sig != expected {
+			t.Fatalf("%s: expected %v got %v", name, expected, sig)
+		}
+	}
+
+	for _, invalid := range []string{"", "FOO", "SIG", "0", "65"} {
+		if _, err := ParseSignal(invalid); err == nil {
+			t.Fatalf("%q should be rejected", invalid)
+		}
+	}
+	fmt.Println("done")
+}
+
+func Test_signalName(t *testing.T) {
+	fmt.Printf("signal name ... ")
+
+	if name := SignalName(syscall.SIGKILL); name != "SIGKILL" {
+		t.Fatalf("expected SIGKILL got %s", name)
+	}
+	if name := SignalName(syscall.Signal(40)); name != "40" {
+		t.Fatalf("expected 40 got %s", name)
+	}
+	fmt.Println("done")
+}
+
+func Test_parseSignalMap(t *testing.T) {
+	fmt.Printf("parse signal map ... ")
+
+	m, err := ParseSignalMap([]string{"HUP=USR2", "SIGQUIT=usr1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 2 || m[syscall.SIGHUP] != syscall.SIGUSR2 || m[syscall.SIGQUIT] != syscall.SIGUSR1 {
+		t.Fatalf("unexpected map %v", m)
+	}
+
+	for _, invalid := range [][]string{{"HUP"}, {"HUP=FOO"}, {"=USR2"}, {"HUP=USR1", "HUP=USR2"},
+		{"SIGINT=quit"}, {"TERM=QUIT"}, {"WINCH=HUP"}, {"KILL=HUP"}, {"STOP=HUP"}} {
+		if _, err := ParseSignalMap(invalid); err == nil {
+			t.Fatalf("%v should be rejected", invalid)
+		}
+	}
+	fmt.Println("done")
+}
+
+func Test_forwarded(t *testing.T) {
+	fmt.Printf("forwarded signals ... ")
+
+	for _, sig := range []syscall.Signal{syscall.SIGCHLD, syscall.SIGURG, syscall.SIGPIPE} {
+		if Forwarded(sig) {
+			t.Fatalf("%s should not be forwarded", SignalName(sig))
+		}
+	}
+	for _, sig := range []syscall.Signal{syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGQUIT, syscall.SIGTERM} {
+		if !Forwarded(sig) {
+			t.Fatalf("%s should be forwarded", SignalName(sig))
+		}
+	}
+	fmt.Println("done")
+}
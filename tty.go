@@ -76,6 +76,11 @@ func (t *tty) attach(s *stream.Stream) error {
 	return nil
 }
 
+// set the console size, for consoles not attached to the current terminal (psdock attach)
+func (t *tty) setSize(height, width uint16) error {
+	return term.SetWinsize(t.console.Fd(), &term.Winsize{Height: height, Width: width})
+}
+
 func (t *tty) resize() error {
 	ws, err := term.GetWinsize(os.Stdin.Fd())
 	if err != nil {
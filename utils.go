@@ -1,8 +1,18 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"os/exec"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/codegangsta/cli"
+	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/utils"
+
+	"github.com/applidget/psdock/environ"
 	"github.com/applidget/psdock/stream"
 )
 
@@ -14,3 +24,61 @@ func parsePrefixArg(prefix string) (string, stream.Color) {
 	}
 	return comps[0], stream.MapColor(comps[len(comps)-1])
 }
+
+// process environment, by order of precedence: psdock variables, -env, -env-file, -env-inherit and standard env
+func loadEnv(cuid string, c *cli.Context) ([]string, error) {
+	inherited, err := environ.Inherit(c.StringSlice("env-inherit"), os.Environ())
+	if err != nil {
+		return nil, err
+	}
+
+	envs := [][]string{standardEnv, inherited}
+	for _, file := range c.StringSlice("env-file") {
+		env, err := environ.ParseFile(file)
+		if err != nil {
+			return nil, err
+		}
+		envs = append(envs, env)
+	}
+
+	psdockEnv := []string{
+		"PSDOCK_CONTAINER_ID=" + cuid,
+		"PSDOCK_HOSTNAME=" + c.String("hostname"),
+	}
+	if c.Bool("notify") {
+		psdockEnv = append(psdockEnv, "NOTIFY_SOCKET="+notifySocketPath)
+		if watchdog := c.Duration("watchdog"); watchdog > 0 {
+			psdockEnv = append(psdockEnv, fmt.Sprintf("WATCHDOG_USEC=%d", watchdog/time.Microsecond))
+		}
+	}
+	envs = append(envs, c.StringSlice("env"), psdockEnv)
+
+	return environ.Merge(envs...), nil
+}
+
+// wait for the process to exit and return its exit status
+func wait(process *libcontainer.Process) (int, error) {
+	status, err := waitStatus(process)
+	if err != nil {
+		return 1, err
+	}
+	return utils.ExitStatus(status), nil
+}
+
+// wait status of a process which exited with code
+func exitedWith(code int) syscall.WaitStatus {
+	return syscall.WaitStatus(code << 8)
+}
+
+// wait for the process to exit and return its raw wait status
+func waitStatus(process *libcontainer.Process) (syscall.WaitStatus, error) {
+	state, err := process.Wait()
+	if err != nil {
+		exitError, ok := err.(*exec.ExitError)
+		if !ok {
+			return 0, err
+		}
+		state = exitError.ProcessState
+	}
+	return state.Sys().(syscall.WaitStatus), nil
+}